@@ -8,9 +8,10 @@ import (
 	"github.com/jfrog/jfrog-cli-core/v2/artifactory/utils"
 	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
 	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
-	"github.com/jfrog/jfrog-client-go/artifactory"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
 func GetAuditCommand() components.Command {
@@ -34,40 +35,175 @@ func auditCmd(c *components.Context) error {
 	if err != nil {
 		return err
 	}
-	return doAudit(rtDetails)
+	config, err := getAuditConfig(c)
+	if err != nil {
+		return err
+	}
+	return doAudit(rtDetails, config)
+}
+
+type auditConfig struct {
+	format      string
+	metricsFile string
+	stateFile   string
+	notifier    *notifier
+	repoFilter  *repoFilter
+}
+
+func getAuditConfig(c *components.Context) (*auditConfig, error) {
+	filter, err := getRepoFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	format := c.GetStringFlagValue("format")
+	if !containsString(auditFormats, format) {
+		return nil, fmt.Errorf("unsupported format '%s', expected one of: %s", format, strings.Join(auditFormats, ", "))
+	}
+	notifier, err := getNotifier(c)
+	if err != nil {
+		return nil, err
+	}
+	return &auditConfig{
+		format:      format,
+		metricsFile: c.GetStringFlagValue("metrics-file"),
+		stateFile:   c.GetStringFlagValue("state-file"),
+		notifier:    notifier,
+		repoFilter:  filter,
+	}, nil
+}
+
+func doAudit(artifactoryDetails *config.ServerDetails, auditConfig *auditConfig) error {
+	startTime := time.Now()
+	results, err := collectAuditResults(artifactoryDetails, auditConfig.repoFilter)
+	if err != nil {
+		return err
+	}
+	if auditConfig.metricsFile != "" {
+		err = writePrometheusFile(auditConfig.metricsFile, getAuditMetrics(results, time.Since(startTime), time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+	if auditConfig.notifier != nil || auditConfig.stateFile != "" {
+		err = notifyFindingsChange("audit", auditConfig.notifier, auditConfig.stateFile, getFindings(results))
+		if err != nil {
+			return err
+		}
+	}
+	switch auditConfig.format {
+	case "markdown":
+		return writeMarkdown(os.Stdout, results)
+	case "junit":
+		return writeJUnit(os.Stdout, results)
+	default:
+		printAsTable(results)
+		return nil
+	}
 }
 
-func doAudit(artifactoryDetails *config.ServerDetails) error {
+func collectAuditResults(artifactoryDetails *config.ServerDetails, filter *repoFilter) ([]auditResult, error) {
 	// Create service-manager.
 	serviceManager, err := utils.CreateServiceManager(artifactoryDetails, -1, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get all repositories.
 	repositoryDetails, err := serviceManager.GetAllRepositories()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get all repository configurations.
+	// Filtered out repositories are still collected, since virtual repositories safety depends on them.
 	localRemoteReposConfig := map[string]*CommonRepositoryDetails{}
-	var repositoryConfigs []CommonRepositoryDetails
+	var repositoryConfigs []*VirtualRepositoryDetails
 	for _, repositoryDetail := range *repositoryDetails {
-		repositoryConfig := CommonRepositoryDetails{}
-		err := serviceManager.GetRepository(repositoryDetail.Key, &repositoryConfig)
+		repositoryConfig := &VirtualRepositoryDetails{}
+		err := serviceManager.GetRepository(repositoryDetail.Key, repositoryConfig)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		localRemoteReposConfig[repositoryConfig.Key] = &repositoryConfig.CommonRepositoryDetails
+		if filter.matchesRepo(&repositoryConfig.CommonRepositoryDetails) {
+			repositoryConfigs = append(repositoryConfigs, repositoryConfig)
 		}
-		repositoryConfigs = append(repositoryConfigs, repositoryConfig)
-		localRemoteReposConfig[repositoryConfig.Key] = &repositoryConfig
 	}
+	return auditRepositories(repositoryConfigs, localRemoteReposConfig), nil
+}
+
+var auditFormats = []string{"table", "markdown", "junit"}
 
-	printAsTable(repositoryConfigs, localRemoteReposConfig, serviceManager)
-	return nil
+const (
+	ruleXrayIndex              = "xray-index"
+	rulePriorityResolution     = "priority-resolution"
+	ruleIncludeExcludePatterns = "include-exclude-patterns"
+	ruleVirtualMembers         = "virtual-members"
+)
+
+// A single rule a repository did not pass.
+type auditFailure struct {
+	Rule   string
+	Reason string
+}
+
+type auditResult struct {
+	Repo     CommonRepositoryDetails
+	Failures []auditFailure
+}
+
+func (ar *auditResult) isAtRisk() bool {
+	return len(ar.Failures) > 0
+}
+
+func (ar *auditResult) verdict() string {
+	if ar.isAtRisk() {
+		return "At risk"
+	}
+	return "Safe"
+}
+
+// Evaluates the audit rules for each of the repositories, and returns the results sorted by repository key.
+func auditRepositories(repositoryConfigs []*VirtualRepositoryDetails, localRemoteReposConfig map[string]*CommonRepositoryDetails) []auditResult {
+	var results []auditResult
+	for _, repositoryConfig := range repositoryConfigs {
+		results = append(results, auditResult{
+			Repo:     repositoryConfig.CommonRepositoryDetails,
+			Failures: auditRepository(repositoryConfig, localRemoteReposConfig),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Repo.Key < results[j].Repo.Key
+	})
+	return results
 }
 
-func printAsTable(repositoryConfigs []CommonRepositoryDetails, localRemoteReposConfig map[string]*CommonRepositoryDetails, serviceManager artifactory.ArtifactoryServicesManager) error {
+func auditRepository(repositoryConfig *VirtualRepositoryDetails, localRemoteReposConfig map[string]*CommonRepositoryDetails) []auditFailure {
+	var failures []auditFailure
+	// Checking if Exclude & Include patterns are empty OR repo is local without priority resolution OR repo is not indexing by xray
+	if strings.EqualFold(repositoryConfig.Rclass, "local") {
+		if !repositoryConfig.PriorityResolution {
+			failures = append(failures, auditFailure{rulePriorityResolution, "Priority resolution is disabled."})
+		}
+		if !repositoryConfig.XrayIndex {
+			failures = append(failures, auditFailure{ruleXrayIndex, "Repository is not indexed by Xray."})
+		}
+	} else if strings.EqualFold(repositoryConfig.Rclass, "remote") {
+		if repositoryConfig.ExcludesPattern == "" && repositoryConfig.IncludesPattern == "**/*" {
+			failures = append(failures, auditFailure{ruleIncludeExcludePatterns, "No include or exclude patterns are configured."})
+		}
+		if !repositoryConfig.XrayIndex {
+			failures = append(failures, auditFailure{ruleXrayIndex, "Repository is not indexed by Xray."})
+		}
+	} else if strings.EqualFold(repositoryConfig.Rclass, "virtual") {
+		for _, reason := range getVirtualRepoRisks(repositoryConfig, localRemoteReposConfig) {
+			failures = append(failures, auditFailure{ruleVirtualMembers, reason})
+		}
+	}
+	return failures
+}
+
+func printAsTable(results []auditResult) {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.AppendHeader(table.Row{"#", "Name", "Type", "Package type", "Include patterns", "Exclude patterns",
@@ -80,54 +216,30 @@ func printAsTable(repositoryConfigs []CommonRepositoryDetails, localRemoteReposC
 		{Number: 9, Align: text.AlignCenter},
 	})
 	riskCount := 0
-	for i, repositoryConfig := range repositoryConfigs {
-		riskString := "Safe"
-		// Checking if Exclude & Include patterns are empty OR repo is local without priority resolution OR repo is not indexing by xray
-		if strings.EqualFold(repositoryConfig.Rclass, "local") {
-			if (repositoryConfig.PriorityResolution == false) || (repositoryConfig.XrayIndex == false) {
-				riskString = "At risk"
-				riskCount += 1
-			}
-		} else if strings.EqualFold(repositoryConfig.Rclass, "remote") {
-			if ((repositoryConfig.ExcludesPattern == "") && (repositoryConfig.IncludesPattern == "**/*")) || (repositoryConfig.XrayIndex == false) {
-				riskString = "At risk"
-				riskCount += 1
-			}
-		} else if strings.EqualFold(repositoryConfig.Rclass, "virtual") {
-			virtualRepositoryConfig := VirtualRepositoryDetails{}
-			err := serviceManager.GetRepository(repositoryConfig.Key, &virtualRepositoryConfig)
-			if err != nil {
-				return err
-			}
-			isRepoSafe := checkVirtualRepoSafety(&virtualRepositoryConfig, localRemoteReposConfig)
-			if !isRepoSafe {
-				riskString = "At risk"
-				riskCount += 1
-			}
-		}
-
-		// Set output params
-		incPatterns := "Not configured"
-		if repositoryConfig.IncludesPattern != "**/*" {
-			incPatterns = "Configured"
-		}
-		excPatterns := "Not configured"
-		if repositoryConfig.ExcludesPattern != "" {
-			excPatterns = "Configured"
+	for i, result := range results {
+		repositoryConfig := result.Repo
+		if result.isAtRisk() {
+			riskCount += 1
 		}
-
 		if strings.EqualFold(repositoryConfig.Rclass, "virtual") {
 			t.AppendRow(table.Row{i, repositoryConfig.Key, repositoryConfig.Rclass, repositoryConfig.PackageType,
-				"-", "-", "-", "-", riskString})
+				"-", "-", "-", "-", result.verdict()})
 		} else {
 			t.AppendRow(table.Row{i, repositoryConfig.Key, repositoryConfig.Rclass, repositoryConfig.PackageType,
-				incPatterns, excPatterns, repositoryConfig.PriorityResolution, repositoryConfig.XrayIndex, riskString})
+				patternsStatus(repositoryConfig.IncludesPattern != "**/*"), patternsStatus(repositoryConfig.ExcludesPattern != ""),
+				repositoryConfig.PriorityResolution, repositoryConfig.XrayIndex, result.verdict()})
 		}
 		t.AppendSeparator()
 	}
 	t.AppendFooter(table.Row{"", "", "", "", "", "", "", "Total at risk", riskCount})
 	t.Render()
-	return nil
+}
+
+func patternsStatus(configured bool) string {
+	if configured {
+		return "Configured"
+	}
+	return "Not configured"
 }
 
 func getAuditArguments() []components.Argument {
@@ -135,10 +247,17 @@ func getAuditArguments() []components.Argument {
 }
 
 func getAuditFlags() []components.Flag {
-	return []components.Flag{
+	return append([]components.Flag{
 		components.StringFlag{
 			Name:        "server-id",
 			Description: "Artifactory server ID configured using the config command.",
 		},
-	}
+		components.StringFlag{
+			Name:         "format",
+			Description:  "[Default: table] Output format of the audit results. Supported values: table, markdown, junit.",
+			DefaultValue: "table",
+		},
+		getMetricsFileFlag(),
+		getStateFileFlag(),
+	}, append(getNotifierFlags(), getRepoFilterFlags()...)...)
 }
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAuditRepositories(t *testing.T) {
+	safeLocal := &VirtualRepositoryDetails{CommonRepositoryDetails: CommonRepositoryDetails{
+		Key: "local1", Rclass: "local", XrayIndex: true, PriorityResolution: true, IncludesPattern: "**/*"}}
+	unsafeLocal := &VirtualRepositoryDetails{CommonRepositoryDetails: CommonRepositoryDetails{
+		Key: "local2", Rclass: "local", IncludesPattern: "**/*"}}
+	unsafeRemote := &VirtualRepositoryDetails{CommonRepositoryDetails: CommonRepositoryDetails{
+		Key: "remote1", Rclass: "remote", XrayIndex: true, IncludesPattern: "**/*"}}
+	virtual := &VirtualRepositoryDetails{CommonRepositoryDetails: CommonRepositoryDetails{
+		Key: "a-virtual", Rclass: "virtual"}, Repositories: []string{"local1", "remote1"}}
+	allRepos := map[string]*CommonRepositoryDetails{}
+	for _, repo := range []*VirtualRepositoryDetails{safeLocal, unsafeLocal, unsafeRemote} {
+		allRepos[repo.Key] = &repo.CommonRepositoryDetails
+	}
+
+	results := auditRepositories([]*VirtualRepositoryDetails{unsafeRemote, safeLocal, virtual, unsafeLocal}, allRepos)
+	assert.Len(t, results, 4)
+
+	// Results are sorted by key.
+	assert.Equal(t, "a-virtual", results[0].Repo.Key)
+	assert.Equal(t, []auditFailure{{ruleVirtualMembers, "Member remote repository 'remote1' has no include or exclude patterns configured."}}, results[0].Failures)
+
+	assert.Equal(t, "local1", results[1].Repo.Key)
+	assert.False(t, results[1].isAtRisk())
+
+	assert.Equal(t, "local2", results[2].Repo.Key)
+	assert.Equal(t, []auditFailure{
+		{rulePriorityResolution, "Priority resolution is disabled."},
+		{ruleXrayIndex, "Repository is not indexed by Xray."},
+	}, results[2].Failures)
+
+	assert.Equal(t, "remote1", results[3].Repo.Key)
+	assert.Equal(t, []auditFailure{{ruleIncludeExcludePatterns, "No include or exclude patterns are configured."}}, results[3].Failures)
+}
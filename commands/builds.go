@@ -0,0 +1,355 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/artifactory/buildinfo"
+	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"github.com/jfrog/jfrog-client-go/utils/errorutils"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Selects the builds to include in the graph. All the filters are applied before the build info is fetched.
+type buildSelection struct {
+	// Number of latest builds of each build name to include, or 0 for all of them.
+	history int
+	// Only builds started at or after this time are included, unless zero.
+	since           time.Time
+	includePatterns []*regexp.Regexp
+	excludePatterns []*regexp.Regexp
+	// Only builds of this project are included, unless empty.
+	project string
+	// Only builds promoted with one of these statuses are included, unless empty.
+	statuses []string
+}
+
+func getBuildSelection(c *components.Context) (*buildSelection, error) {
+	includePatterns, err := wildcardsToRegExps(splitFlagList(c.GetStringFlagValue("include-builds")))
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := wildcardsToRegExps(splitFlagList(c.GetStringFlagValue("exclude-builds")))
+	if err != nil {
+		return nil, err
+	}
+	selection := &buildSelection{
+		includePatterns: includePatterns,
+		excludePatterns: excludePatterns,
+		project:         c.GetStringFlagValue("build-project"),
+		statuses:        splitFlagList(c.GetStringFlagValue("build-status")),
+	}
+	if value := c.GetStringFlagValue("builds-since"); value != "" {
+		since, err := parseBuildsSince(value)
+		if err != nil {
+			return nil, err
+		}
+		selection.since = since
+	}
+	history := c.GetStringFlagValue("build-history")
+	if history == "" {
+		// By default, only the latest build is included, or all the builds since the date if provided.
+		if selection.since.IsZero() {
+			selection.history = 1
+		}
+		return selection, nil
+	}
+	number, err := strconv.Atoi(history)
+	if err != nil || number <= 0 {
+		return nil, errors.New("build-history must be a positive number")
+	}
+	selection.history = number
+	return selection, nil
+}
+
+func parseBuildsSince(value string) (time.Time, error) {
+	if since, err := time.Parse("2006-01-02", value); err == nil {
+		return since, nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("builds-since must be a date (2006-01-02) or a time (2006-01-02T15:04:05Z07:00)")
+	}
+	return since, nil
+}
+
+// Returns the build names to include. Build names without builds since the selection date are skipped,
+// and so are build names without promoted builds, if promoted is not nil.
+func (bs *buildSelection) selectBuilds(builds []Build, promoted map[string]bool) []Build {
+	var selected []Build
+	for _, build := range builds {
+		name := build.name()
+		if len(bs.includePatterns) > 0 && !matchesAny(bs.includePatterns, name) || matchesAny(bs.excludePatterns, name) {
+			continue
+		}
+		if !bs.since.IsZero() && build.LastStarted != "" && build.lastStartedTime().Before(bs.since) {
+			continue
+		}
+		if promoted != nil && !promoted[name] {
+			continue
+		}
+		selected = append(selected, build)
+	}
+	return selected
+}
+
+// Returns true if only the latest build of each build name is selected, which is fetched without listing the build runs.
+func (bs *buildSelection) latestOnly() bool {
+	return bs.history == 1 && bs.since.IsZero() && len(bs.statuses) == 0
+}
+
+// Returns the selected build runs, from the oldest to the newest.
+// If promoted is not nil, only the runs it contains are selected.
+func (bs *buildSelection) selectRuns(buildName string, runs []BuildRun, promoted map[string]bool) []BuildRun {
+	var selected []BuildRun
+	for _, run := range runs {
+		if !bs.since.IsZero() && run.startedTime().Before(bs.since) {
+			continue
+		}
+		if promoted != nil && !promoted[buildRunKey(buildName, run.number())] {
+			continue
+		}
+		selected = append(selected, run)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].startedTime().Before(selected[j].startedTime())
+	})
+	if bs.history > 0 && len(selected) > bs.history {
+		selected = selected[len(selected)-bs.history:]
+	}
+	return selected
+}
+
+type BuildRuns struct {
+	BuildsNumbers []BuildRun `json:"buildsNumbers"`
+}
+
+type BuildRun struct {
+	Uri     string `json:"uri"`
+	Started string `json:"started"`
+}
+
+func (br *BuildRun) number() string {
+	return buildNameFromUri(br.Uri)
+}
+
+// Returns the time the build started, or the zero time if it can't be parsed.
+func (br *BuildRun) startedTime() time.Time {
+	return parseBuildTime(br.Started)
+}
+
+func (b *Build) name() string {
+	return buildNameFromUri(b.Uri)
+}
+
+func (b *Build) lastStartedTime() time.Time {
+	return parseBuildTime(b.LastStarted)
+}
+
+func parseBuildTime(value string) time.Time {
+	parsed, err := time.Parse(buildinfo.TimeFormat, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
+
+func buildRunKey(buildName, buildNumber string) string {
+	return buildName + "\x00" + buildNumber
+}
+
+// Returns the unescaped build name or number from a build list uri, e.g. "/my%20build".
+func buildNameFromUri(uri string) string {
+	if len(uri) > 0 && uri[0] == '/' {
+		uri = uri[1:]
+	}
+	name, err := url.PathUnescape(uri)
+	if err != nil {
+		return uri
+	}
+	return name
+}
+
+// The build info, with the promotion statuses which are not part of buildinfo.BuildInfo.
+type buildInfoWithStatuses struct {
+	buildinfo.BuildInfo
+	Statuses []BuildStatus `json:"statuses,omitempty"`
+}
+
+// Returns the latest promotion status of the build, or an empty string if it was never promoted.
+func (bi *buildInfoWithStatuses) status() string {
+	if len(bi.Statuses) == 0 {
+		return ""
+	}
+	return bi.Statuses[len(bi.Statuses)-1].Status
+}
+
+type BuildStatus struct {
+	Status     string `json:"status"`
+	Repository string `json:"repository"`
+	Timestamp  string `json:"timestamp"`
+}
+
+type publishedBuildInfoWithStatuses struct {
+	BuildInfo buildInfoWithStatuses `json:"buildInfo"`
+}
+
+// Returns the query string restricting build requests to the selected project.
+func (bs *buildSelection) projectQuery() string {
+	if bs.project == "" {
+		return ""
+	}
+	return "?project=" + url.QueryEscape(bs.project)
+}
+
+func (gb *GraphBuilder) getBuildRuns(buildName string) ([]BuildRun, error) {
+	resp, respBody, _, err := gb.serviceManager.Client().SendGet(fmt.Sprintf("%sapi/build/%s%s", gb.baseUrl, url.PathEscape(buildName),
+		gb.builderConfig.buildSelection.projectQuery()), true, &gb.clientDetails)
+	if err != nil {
+		return nil, err
+	}
+	if err = errorutils.CheckResponseStatus(resp, http.StatusOK); err != nil {
+		return nil, errorutils.GenerateResponseError(resp.Status, clientutils.IndentJson(respBody))
+	}
+	var runs BuildRuns
+	if err = json.Unmarshal(respBody, &runs); err != nil {
+		return nil, err
+	}
+	return runs.BuildsNumbers, nil
+}
+
+// Returns the build info, or false if the build was not found.
+// The modules of a build number don't change, but its promotion statuses do, so the build info is cached with the build TTL.
+func (gb *GraphBuilder) getBuildInfo(buildName, buildNumber string) (*buildInfoWithStatuses, bool, error) {
+	cacheKey := gb.buildInfoCacheKey(buildName, buildNumber)
+	cached := &buildInfoWithStatuses{}
+	if gb.cache != nil && gb.cache.get(cacheBuilds, cacheKey, gb.builderConfig.cache.buildTTL, cached) {
+		return cached, true, nil
+	}
+	buildInfo, found, err := gb.fetchBuildInfo(buildName, buildNumber)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	gb.cache.put(cacheBuilds, cacheKey, buildInfo)
+	return buildInfo, true, nil
+}
+
+// Returns the latest build info of the build name, or false if it has no builds.
+// The latest build changes, so it is always fetched, and cached by its build number.
+func (gb *GraphBuilder) getLatestBuildInfo(buildName string) (*buildInfoWithStatuses, bool, error) {
+	buildInfo, found, err := gb.fetchBuildInfo(buildName, "LATEST")
+	if err != nil || !found {
+		return nil, found, err
+	}
+	gb.cache.put(cacheBuilds, gb.buildInfoCacheKey(buildName, buildInfo.Number), buildInfo)
+	return buildInfo, true, nil
+}
+
+func (gb *GraphBuilder) buildInfoCacheKey(buildName, buildNumber string) string {
+	return buildRunKey(buildName, buildNumber) + "\x00" + gb.builderConfig.buildSelection.project
+}
+
+func (gb *GraphBuilder) fetchBuildInfo(buildName, buildNumber string) (*buildInfoWithStatuses, bool, error) {
+	resp, respBody, _, err := gb.serviceManager.Client().SendGet(fmt.Sprintf("%sapi/build/%s/%s%s", gb.baseUrl, url.PathEscape(buildName),
+		url.PathEscape(buildNumber), gb.builderConfig.buildSelection.projectQuery()), true, &gb.clientDetails)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err = errorutils.CheckResponseStatus(resp, http.StatusOK); err != nil {
+		return nil, false, errorutils.GenerateResponseError(resp.Status, clientutils.IndentJson(respBody))
+	}
+	published := &publishedBuildInfoWithStatuses{}
+	if err = json.Unmarshal(respBody, published); err != nil {
+		return nil, true, err
+	}
+	return &published.BuildInfo, true, nil
+}
+
+// Returns the names of the builds promoted with one of the selected statuses, and their build run keys.
+// Returns nil if no statuses are selected.
+func (gb *GraphBuilder) getPromotedBuilds() (map[string]bool, error) {
+	statuses := gb.builderConfig.buildSelection.statuses
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	stream, err := gb.serviceManager.Aql(createAqlQueryForPromotedBuilds(statuses))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	promoted := map[string]bool{}
+	if len(content) == 0 {
+		return promoted, nil
+	}
+	var results PromotedBuildsAqlResults
+	if err = json.Unmarshal(content, &results); err != nil {
+		return nil, err
+	}
+	for _, result := range results.Results {
+		promoted[result.Name] = true
+		promoted[buildRunKey(result.Name, result.Number)] = true
+	}
+	return promoted, nil
+}
+
+func createAqlQueryForPromotedBuilds(statuses []string) string {
+	var criteria []string
+	for _, status := range statuses {
+		value, _ := json.Marshal(status)
+		criteria = append(criteria, fmt.Sprintf(`{"promotion.status": %s}`, value))
+	}
+	return fmt.Sprintf(`builds.find({"$or": [%s]}).include("build.name", "build.number")`, strings.Join(criteria, ", "))
+}
+
+type PromotedBuildsAqlResults struct {
+	Results []PromotedBuildResult `json:"results"`
+}
+
+type PromotedBuildResult struct {
+	Name   string `json:"build.name"`
+	Number string `json:"build.number"`
+}
+
+func getBuildSelectionFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name:        "include-builds",
+			Description: "Comma-separated list of wildcard patterns. Only builds with a matching name are included.",
+		},
+		components.StringFlag{
+			Name:        "exclude-builds",
+			Description: "Comma-separated list of wildcard patterns. Builds with a matching name are skipped.",
+		},
+		components.StringFlag{
+			Name:        "build-project",
+			Description: "Project key. Only builds of this project are included.",
+		},
+		components.StringFlag{
+			Name:        "build-status",
+			Description: "Comma-separated list of promotion statuses (e.g. released). Only builds promoted with one of these statuses are included.",
+		},
+		components.StringFlag{
+			Name:        "build-history",
+			Description: "[Default: 1] Number of latest builds of each build name to include. Without it, all the builds since builds-since are included if provided.",
+		},
+		components.StringFlag{
+			Name:        "builds-since",
+			Description: "Only include builds started since this date (2006-01-02) or time (2006-01-02T15:04:05Z07:00).",
+		},
+	}
+}
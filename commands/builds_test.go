@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Returns a graph builder connected to a fake Artifactory, serving the responses by request URI, or by path.
+// AQL queries are answered with no results, unless an "/api/search/aql" response is provided.
+func newTestGraphBuilder(t *testing.T, responses map[string]string, builderConfig *graphBuilderConfig) *GraphBuilder {
+	return newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			response, ok = responses[r.URL.EscapedPath()]
+		}
+		if !ok && r.URL.Path == "/api/search/aql" {
+			response, ok = `{"results": []}`, true
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}, builderConfig)
+}
+
+func newTestGraphBuilderWithHandler(t *testing.T, handler http.HandlerFunc, builderConfig *graphBuilderConfig) *GraphBuilder {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	gb, err := newGraphBuilder(&config.ServerDetails{ArtifactoryUrl: server.URL + "/"}, builderConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gb
+}
+
+func TestSelectRuns(t *testing.T) {
+	runs := []BuildRun{
+		{Uri: "/3", Started: "2021-03-01T10:00:00.000+0000"},
+		{Uri: "/1", Started: "2021-01-01T10:00:00.000+0000"},
+		{Uri: "/2", Started: "2021-02-01T10:00:00.000+0000"},
+	}
+	numbers := func(runs []BuildRun) []string {
+		var numbers []string
+		for _, run := range runs {
+			numbers = append(numbers, run.number())
+		}
+		return numbers
+	}
+	assert.Equal(t, []string{"3"}, numbers((&buildSelection{history: 1}).selectRuns("build", runs, nil)))
+	assert.Equal(t, []string{"2", "3"}, numbers((&buildSelection{history: 2}).selectRuns("build", runs, nil)))
+	assert.Equal(t, []string{"1", "2", "3"}, numbers((&buildSelection{}).selectRuns("build", runs, nil)))
+	since := time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"2", "3"}, numbers((&buildSelection{since: since}).selectRuns("build", runs, nil)))
+	assert.Equal(t, []string{"3"}, numbers((&buildSelection{since: since, history: 1}).selectRuns("build", runs, nil)))
+}
+
+func TestParseBuildsSince(t *testing.T) {
+	since, err := parseBuildsSince("2021-01-15")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), since)
+	since, err = parseBuildsSince("2021-01-15T10:00:00+02:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 15, 8, 0, 0, 0, time.UTC), since.UTC())
+	_, err = parseBuildsSince("last week")
+	assert.Error(t, err)
+}
+
+func TestBuildNameFromUri(t *testing.T) {
+	assert.Equal(t, "my build", buildNameFromUri("/my%20build"))
+	assert.Equal(t, "build", buildNameFromUri("build"))
+}
+
+func TestHandleBuildsHistory(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{
+		"/api/build/my%20build": `{"buildsNumbers": [
+			{"uri": "/1", "started": "2021-01-01T10:00:00.000+0000"},
+			{"uri": "/3", "started": "2021-03-01T10:00:00.000+0000"},
+			{"uri": "/2", "started": "2021-02-01T10:00:00.000+0000"}]}`,
+		"/api/build/my%20build/2": `{"buildInfo": {"name": "my build", "number": "2", "started": "2021-02-01T10:00:00.000+0000",
+			"modules": [{"id": "module", "dependencies": [{"id": "dep", "sha1": "sha1"}]}]}}`,
+		"/api/build/my%20build/3": `{"buildInfo": {"name": "my build", "number": "3", "started": "2021-03-01T10:00:00.000+0000",
+			"statuses": [{"status": "staged"}, {"status": "released", "repository": "release-local"}]}}`,
+	}, &graphBuilderConfig{buildSelection: &buildSelection{history: 2}, checksumLookup: testChecksumLookup})
+	assert.NoError(t, gb.handleBuilds([]Build{{Uri: "/my%20build"}}))
+
+	build2 := gb.graph.getNode(labelBuild, "my build", "2")
+	build3 := gb.graph.getNode(labelBuild, "my build", "3")
+	if assert.NotNil(t, build2) && assert.NotNil(t, build3) {
+		assert.Equal(t, "2021-02-01T10:00:00.000+0000", build2.properties["started"])
+		assert.NotContains(t, build2.properties, "status")
+		assert.Equal(t, "released", build3.properties["status"])
+		assert.Contains(t, gb.graph.edgeById, build2.id+"\x00"+relNextBuild+"\x00"+build3.id)
+	}
+	assert.Nil(t, gb.graph.getNode(labelBuild, "my build", "1"))
+	assert.Equal(t, map[string]int{relNextBuild: 1, relDependencyFor: 2, relProvides: 1}, gb.graph.edgeCounts())
+}
+
+func TestSelectBuilds(t *testing.T) {
+	builds := []Build{
+		{Uri: "/release-app", LastStarted: "2021-03-01T10:00:00.000+0000"},
+		{Uri: "/release-old", LastStarted: "2020-01-01T10:00:00.000+0000"},
+		{Uri: "/release-lib-test", LastStarted: "2021-03-01T10:00:00.000+0000"},
+		{Uri: "/snapshot-app", LastStarted: "2021-03-01T10:00:00.000+0000"},
+	}
+	names := func(builds []Build) []string {
+		var names []string
+		for _, build := range builds {
+			names = append(names, build.name())
+		}
+		return names
+	}
+	includePatterns, _ := wildcardsToRegExps([]string{"release-*"})
+	excludePatterns, _ := wildcardsToRegExps([]string{"*-test"})
+	selection := &buildSelection{includePatterns: includePatterns, excludePatterns: excludePatterns}
+	assert.Equal(t, []string{"release-app", "release-old"}, names(selection.selectBuilds(builds, nil)))
+	selection.since = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"release-app"}, names(selection.selectBuilds(builds, nil)))
+	assert.Empty(t, selection.selectBuilds(builds, map[string]bool{"snapshot-app": true}))
+}
+
+func TestSelectRunsPromoted(t *testing.T) {
+	runs := []BuildRun{{Uri: "/1", Started: "2021-01-01T10:00:00.000+0000"}, {Uri: "/2", Started: "2021-02-01T10:00:00.000+0000"}}
+	selected := (&buildSelection{history: 1}).selectRuns("build", runs, map[string]bool{"build": true, buildRunKey("build", "1"): true})
+	assert.Equal(t, []BuildRun{runs[0]}, selected)
+}
+
+func TestCreateAqlQueryForPromotedBuilds(t *testing.T) {
+	assert.Equal(t, `builds.find({"$or": [{"promotion.status": "released"}, {"promotion.status": "qa\"ok"}]}).include("build.name", "build.number")`,
+		createAqlQueryForPromotedBuilds([]string{"released", `qa"ok`}))
+}
+
+func TestHandleBuildsFilters(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{
+		"/api/search/aql": `{"results": [{"build.name": "app", "build.number": "1"}]}`,
+		"/api/build/app?project=proj": `{"buildsNumbers": [
+			{"uri": "/1", "started": "2021-01-01T10:00:00.000+0000"},
+			{"uri": "/2", "started": "2021-02-01T10:00:00.000+0000"}]}`,
+		"/api/build/app/1?project=proj": `{"buildInfo": {"name": "app", "number": "1", "statuses": [{"status": "released"}]}}`,
+	}, &graphBuilderConfig{buildSelection: &buildSelection{history: 1, project: "proj", statuses: []string{"released"}},
+		checksumLookup: testChecksumLookup})
+	assert.NoError(t, gb.handleBuilds([]Build{{Uri: "/app"}, {Uri: "/other"}}))
+	assert.Equal(t, map[string]int{labelAttacker: 1, labelBuild: 1}, gb.graph.nodeCounts())
+	assert.NotNil(t, gb.graph.getNode(labelBuild, "app", "1"))
+}
+
+func TestHandleBuildsLatest(t *testing.T) {
+	var requests []string
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.EscapedPath())
+		if r.URL.EscapedPath() != "/api/build/app/LATEST" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"buildInfo": {"name": "app", "number": "3", "started": "2021-03-01T10:00:00.000+0000"}}`))
+	}, &graphBuilderConfig{buildSelection: &buildSelection{history: 1}, checksumLookup: testChecksumLookup})
+	assert.NoError(t, gb.handleBuilds([]Build{{Uri: "/app"}, {Uri: "/other"}}))
+	assert.Equal(t, []string{"/api/build/app/LATEST", "/api/build/other/LATEST"}, requests)
+	assert.Equal(t, map[string]int{labelAttacker: 1, labelBuild: 1}, gb.graph.nodeCounts())
+	assert.NotNil(t, gb.graph.getNode(labelBuild, "app", "3"))
+	assert.Equal(t, map[string]processedBuild{"app": {Number: "3", Started: "2021-03-01T10:00:00.000+0000"}}, gb.processedBuilds)
+}
@@ -0,0 +1,320 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-cli-core/v2/utils/coreutils"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	cacheChecksums       = "checksums"
+	cacheRepositories    = "repositories"
+	cacheBuilds          = "builds"
+	cacheReleaseBundles  = "release-bundles"
+	cacheDockerManifests = "docker-manifests"
+)
+
+var cacheNamespaces = []string{cacheChecksums, cacheRepositories, cacheBuilds, cacheReleaseBundles, cacheDockerManifests}
+
+// A cache of Artifactory responses on disk, with a file per entry. A nil cache never has any entry.
+type fileCache struct {
+	dir string
+}
+
+type cacheEntry struct {
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"storedAt"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// Configures the cache of the graph command.
+type cacheConfig struct {
+	disabled    bool
+	dir         string
+	checksumTTL time.Duration
+	repoTTL     time.Duration
+	// The build info includes the promotion statuses, which change when the build is promoted.
+	buildTTL time.Duration
+}
+
+func getCacheConfig(c *components.Context) (*cacheConfig, error) {
+	checksumTTL, err := time.ParseDuration(c.GetStringFlagValue("checksum-cache-ttl"))
+	if err != nil || checksumTTL < 0 {
+		return nil, errors.New("checksum-cache-ttl must be a non-negative duration, e.g. 24h")
+	}
+	repoTTL, err := time.ParseDuration(c.GetStringFlagValue("repo-cache-ttl"))
+	if err != nil || repoTTL < 0 {
+		return nil, errors.New("repo-cache-ttl must be a non-negative duration, e.g. 1h")
+	}
+	buildTTL, err := time.ParseDuration(c.GetStringFlagValue("build-cache-ttl"))
+	if err != nil || buildTTL < 0 {
+		return nil, errors.New("build-cache-ttl must be a non-negative duration, e.g. 1h")
+	}
+	return &cacheConfig{
+		disabled:    c.GetBoolFlagValue("no-cache"),
+		dir:         c.GetStringFlagValue("cache-dir"),
+		checksumTTL: checksumTTL,
+		repoTTL:     repoTTL,
+		buildTTL:    buildTTL,
+	}, nil
+}
+
+var unsafeFileNameRegExp = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Returns the cache of the server, or nil if the cache is disabled.
+func newServerCache(config *cacheConfig, serverId string) (*fileCache, error) {
+	if config == nil || config.disabled {
+		return nil, nil
+	}
+	baseDir := config.dir
+	if baseDir == "" {
+		homeDir, err := coreutils.GetJfrogHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		baseDir = filepath.Join(homeDir, "stechhelm", "cache")
+	}
+	if serverId == "" {
+		serverId = "default"
+	}
+	return &fileCache{dir: filepath.Join(baseDir, unsafeFileNameRegExp.ReplaceAllString(serverId, "_"))}, nil
+}
+
+func (fc *fileCache) entryPath(namespace, key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(fc.dir, namespace, hex.EncodeToString(hash[:])+".json")
+}
+
+// Reads the entry into value. Returns false if the entry doesn't exist, or is older than the TTL.
+// A zero TTL never expires.
+func (fc *fileCache) get(namespace, key string, ttl time.Duration, value interface{}) bool {
+	if fc == nil {
+		return false
+	}
+	content, err := ioutil.ReadFile(fc.entryPath(namespace, key))
+	if err != nil {
+		return false
+	}
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(content, entry); err != nil || entry.Key != key {
+		return false
+	}
+	if ttl > 0 && time.Since(entry.StoredAt) > ttl {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// Stores the value. Failures are only logged, since the cache is an optimization.
+func (fc *fileCache) put(namespace, key string, value interface{}) {
+	if fc == nil {
+		return
+	}
+	if err := fc.write(namespace, key, value); err != nil {
+		log.Warn(fmt.Sprintf("Failed writing %s cache entry %s: %s", namespace, key, err.Error()))
+	}
+}
+
+func (fc *fileCache) write(namespace, key string, value interface{}) error {
+	rawValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(&cacheEntry{Key: key, StoredAt: time.Now(), Value: rawValue})
+	if err != nil {
+		return err
+	}
+	path := fc.entryPath(namespace, key)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), ".entry-")
+	if err != nil {
+		return err
+	}
+	if _, err = tempFile.Write(content); err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+type cacheNamespaceStats struct {
+	namespace string
+	entries   int
+	size      int64
+	oldest    time.Time
+	newest    time.Time
+}
+
+func (fc *fileCache) stats(namespace string) (*cacheNamespaceStats, error) {
+	stats := &cacheNamespaceStats{namespace: namespace}
+	files, err := ioutil.ReadDir(filepath.Join(fc.dir, namespace))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		stats.entries++
+		stats.size += file.Size()
+		if stats.oldest.IsZero() || file.ModTime().Before(stats.oldest) {
+			stats.oldest = file.ModTime()
+		}
+		if file.ModTime().After(stats.newest) {
+			stats.newest = file.ModTime()
+		}
+	}
+	return stats, nil
+}
+
+func (fc *fileCache) clear(namespace string) error {
+	return os.RemoveAll(filepath.Join(fc.dir, namespace))
+}
+
+func GetCacheCommand() components.Command {
+	return components.Command{
+		Name:        "cache",
+		Description: "Inspect or clear the local cache of the graph and paths commands.",
+		Arguments:   getCacheArguments(),
+		Flags:       getCacheFlags(),
+		Action: func(c *components.Context) error {
+			return cacheCmd(c)
+		},
+	}
+}
+
+func cacheCmd(c *components.Context) error {
+	if len(c.Arguments) != 1 {
+		return errors.New(fmt.Sprintf("Wrong number of arguments. Expected: 1, Received: %d", len(c.Arguments)))
+	}
+	namespaces := cacheNamespaces
+	if namespace := c.GetStringFlagValue("namespace"); namespace != "" {
+		if !containsString(cacheNamespaces, namespace) {
+			return fmt.Errorf("unsupported namespace '%s', expected one of: %s", namespace, strings.Join(cacheNamespaces, ", "))
+		}
+		namespaces = []string{namespace}
+	}
+	rtDetails, err := getRtDetails(c)
+	if err != nil {
+		return err
+	}
+	cache, err := newServerCache(&cacheConfig{dir: c.GetStringFlagValue("cache-dir")}, rtDetails.ServerId)
+	if err != nil {
+		return err
+	}
+	switch c.Arguments[0] {
+	case "info":
+		return printCacheInfo(cache, namespaces)
+	case "clear":
+		for _, namespace := range namespaces {
+			if err = cache.clear(namespace); err != nil {
+				return err
+			}
+		}
+		log.Info("Cleared the cache in " + cache.dir)
+		return nil
+	default:
+		return fmt.Errorf("unsupported action '%s', expected one of: info, clear", c.Arguments[0])
+	}
+}
+
+func printCacheInfo(cache *fileCache, namespaces []string) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(cache.dir)
+	t.AppendHeader(table.Row{"Namespace", "Entries", "Size (bytes)", "Oldest", "Newest"})
+	for _, namespace := range namespaces {
+		stats, err := cache.stats(namespace)
+		if err != nil {
+			return err
+		}
+		oldest, newest := "-", "-"
+		if stats.entries > 0 {
+			oldest = stats.oldest.Format(time.RFC3339)
+			newest = stats.newest.Format(time.RFC3339)
+		}
+		t.AppendRow(table.Row{namespace, stats.entries, stats.size, oldest, newest})
+	}
+	t.Render()
+	return nil
+}
+
+func getCacheArguments() []components.Argument {
+	return []components.Argument{
+		{
+			Name:        "action",
+			Description: "info to show the cached entries, or clear to remove them.",
+		},
+	}
+}
+
+func getCacheFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name:        "server-id",
+			Description: "Artifactory server ID configured using the config command.",
+		},
+		getCacheDirFlag(),
+		components.StringFlag{
+			Name:        "namespace",
+			Description: "Only inspect or clear this part of the cache: checksums, repositories, builds, release-bundles or docker-manifests.",
+		},
+	}
+}
+
+func getCacheDirFlag() components.Flag {
+	return components.StringFlag{
+		Name:        "cache-dir",
+		Description: "[Default: ~/.jfrog/stechhelm/cache] Directory of the cache. Each server has its own sub-directory.",
+	}
+}
+
+// Returns the flags configuring the cache of the commands building the graph.
+func getGraphCacheFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name:         "no-cache",
+			Description:  "[Default: false] Set to true to neither read from nor write to the cache.",
+			DefaultValue: false,
+		},
+		getCacheDirFlag(),
+		components.StringFlag{
+			Name:         "checksum-cache-ttl",
+			Description:  "[Default: 24h] Time to keep the repositories storing a binary checksum in the cache. 0 never expires.",
+			DefaultValue: "24h",
+		},
+		components.StringFlag{
+			Name:         "repo-cache-ttl",
+			Description:  "[Default: 1h] Time to keep repository configurations in the cache. 0 never expires.",
+			DefaultValue: "1h",
+		},
+		components.StringFlag{
+			Name: "build-cache-ttl",
+			Description: "[Default: 1h] Time to keep the build info in the cache. The promotion status of a build is refreshed once it expires. " +
+				"0 never expires.",
+			DefaultValue: "1h",
+		},
+	}
+}
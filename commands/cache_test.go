@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	cache, err := newServerCache(&cacheConfig{dir: t.TempDir()}, "my server/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "my_server_1", filepath.Base(cache.dir))
+
+	var value []string
+	assert.False(t, cache.get(cacheChecksums, "sha1", 0, &value))
+	cache.put(cacheChecksums, "sha1", []string{"repo"})
+	assert.True(t, cache.get(cacheChecksums, "sha1", time.Hour, &value))
+	assert.Equal(t, []string{"repo"}, value)
+	assert.True(t, cache.get(cacheChecksums, "sha1", 0, &value))
+	assert.False(t, cache.get(cacheChecksums, "sha1", time.Nanosecond, &value))
+	assert.False(t, cache.get(cacheRepositories, "sha1", 0, &value))
+
+	stats, err := cache.stats(cacheChecksums)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.entries)
+	assert.NoError(t, cache.clear(cacheChecksums))
+	assert.False(t, cache.get(cacheChecksums, "sha1", 0, &value))
+	stats, err = cache.stats(cacheChecksums)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.entries)
+}
+
+func TestDisabledCache(t *testing.T) {
+	cache, err := newServerCache(&cacheConfig{disabled: true, dir: t.TempDir()}, "server")
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+	var value string
+	cache.put(cacheBuilds, "key", "value")
+	assert.False(t, cache.get(cacheBuilds, "key", 0, &value))
+}
+
+func TestLinkChecksumsToReposCached(t *testing.T) {
+	cacheDir := t.TempDir()
+	var queries int32
+	newBuilder := func() *GraphBuilder {
+		return newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&queries, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(string(body), `"sha1"`) {
+				_, _ = w.Write([]byte(`{"results": [{"repo": "local1", "name": "a.jar", "actual_sha1": "sha1", "sha256": "sha256-1"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"results": []}`))
+		}, &graphBuilderConfig{checksumLookup: testChecksumLookup, cache: &cacheConfig{dir: cacheDir, checksumTTL: time.Hour}})
+	}
+	gb := newBuilder()
+	gb.graphCreateRepoNode("local1", "LOCAL", false, false, false, false)
+	_, err := gb.linkChecksumsToRepos([]string{"sha1", "sha2"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), queries)
+
+	gb = newBuilder()
+	gb.allRepos["local1"] = &CommonRepositoryDetails{Key: "local1", Rclass: "local"}
+	gb.graphCreateRepoNode("local1", "LOCAL", false, false, false, false)
+	_, err = gb.linkChecksumsToRepos([]string{"sha1", "sha2"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), queries)
+	binary := gb.graph.getNode(labelBinary, "sha1")
+	if assert.NotNil(t, binary) {
+		assert.Equal(t, "a.jar", binary.properties["name"])
+		assert.Equal(t, "sha256-1", binary.properties["sha256"])
+	}
+	assert.Equal(t, map[string]int{relStores: 1}, gb.graph.edgeCounts())
+
+	// Results cached without the sha256 checksum are looked up again.
+	gb = newBuilder()
+	gb.cache.put(cacheChecksums, "sha1", []Result{{Repo: "local1", Name: "a.jar", ActualSha1: "sha1"}})
+	_, err = gb.linkChecksumsToRepos([]string{"sha1", "sha2"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), queries)
+}
+
+func TestGetBuildInfoCached(t *testing.T) {
+	cacheDir := t.TempDir()
+	var requests int32
+	newBuilder := func(buildTTL time.Duration) *GraphBuilder {
+		return newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			_, _ = w.Write([]byte(`{"buildInfo": {"name": "app", "number": "1", "statuses": [{"status": "released"}]}}`))
+		}, &graphBuilderConfig{buildSelection: &buildSelection{}, cache: &cacheConfig{dir: cacheDir, buildTTL: buildTTL}})
+	}
+	for i := 0; i < 2; i++ {
+		buildInfo, found, err := newBuilder(time.Hour).getBuildInfo("app", "1")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "1", buildInfo.Number)
+		assert.Equal(t, "released", buildInfo.status())
+	}
+	assert.Equal(t, int32(1), requests)
+	// Expired build info is fetched again, so that promotions are picked up.
+	_, _, err := newBuilder(time.Nanosecond).getBuildInfo("app", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests)
+}
+
+func TestGetRepositoryConfigCachedWithoutUrl(t *testing.T) {
+	cacheDir := t.TempDir()
+	var requests int32
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"key": "remote1", "rclass": "remote", "url": "https://registry.npmjs.org"}`))
+	}, &graphBuilderConfig{cache: &cacheConfig{dir: cacheDir}})
+	// Remote repository configurations cached without their URL are fetched again.
+	gb.cache.put(cacheRepositories, "remote1", &CommonRepositoryDetails{Key: "remote1", Rclass: "remote"})
+	repoConfig := &CommonRepositoryDetails{}
+	assert.NoError(t, gb.getRepositoryConfig("remote1", repoConfig))
+	assert.Equal(t, "https://registry.npmjs.org", repoConfig.Url)
+	assert.Equal(t, int32(1), requests)
+
+	repoConfig = &CommonRepositoryDetails{}
+	assert.NoError(t, gb.getRepositoryConfig("remote1", repoConfig))
+	assert.Equal(t, "https://registry.npmjs.org", repoConfig.Url)
+	assert.Equal(t, int32(1), requests)
+}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/artifactory/utils"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/artifactory"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Configures the AQL queries finding the repositories storing the build binaries.
+type checksumLookupConfig struct {
+	// Number of checksums looked up in a single query.
+	batchSize int
+	// Number of queries running concurrently.
+	threads int
+}
+
+func getChecksumLookupConfig(c *components.Context) (*checksumLookupConfig, error) {
+	batchSize, err := strconv.Atoi(c.GetStringFlagValue("aql-batch-size"))
+	if err != nil || batchSize <= 0 {
+		return nil, errors.New("aql-batch-size must be a positive number")
+	}
+	threads, err := strconv.Atoi(c.GetStringFlagValue("aql-threads"))
+	if err != nil || threads <= 0 {
+		return nil, errors.New("aql-threads must be a positive number")
+	}
+	return &checksumLookupConfig{batchSize: batchSize, threads: threads}, nil
+}
+
+// The unique checksums of the build binaries, in the order they were first added.
+type checksumSet struct {
+	visited map[string]bool
+	values  []string
+}
+
+func newChecksumSet() *checksumSet {
+	return &checksumSet{visited: map[string]bool{}}
+}
+
+func (cs *checksumSet) add(sha1 string) {
+	if !cs.visited[sha1] {
+		cs.visited[sha1] = true
+		cs.values = append(cs.values, sha1)
+	}
+}
+
+// Finds the repositories storing the binaries, and links the binaries to them.
+// Batches are queried concurrently, and the results are linked in the batches order once all the queries are done.
+// Failed batches are logged and skipped, so that a single failure doesn't leave all the binaries unlinked.
+// Returns the checksums of the failed batches.
+func (gb *GraphBuilder) linkChecksumsToRepos(checksums []string) ([]string, error) {
+	lookupConfig := gb.builderConfig.checksumLookup
+	cachedResults, uncached := gb.getCachedChecksumResults(checksums)
+	batches := chunkStrings(uncached, lookupConfig.batchSize)
+	results := make([][]Result, len(batches))
+	succeeded := make([]bool, len(batches))
+	jobs := make(chan int, len(batches))
+	for i := range batches {
+		jobs <- i
+	}
+	close(jobs)
+	// Each worker has its own service manager, since the HTTP client modifies its state when sending POST requests.
+	// They are all created before the workers start, so that no worker is left running when one can't be created.
+	var serviceManagers []artifactory.ArtifactoryServicesManager
+	for worker := 0; worker < lookupConfig.threads && worker < len(batches); worker++ {
+		serviceManager, err := utils.CreateServiceManager(gb.rtDetails, -1, false)
+		if err != nil {
+			return nil, err
+		}
+		serviceManagers = append(serviceManagers, serviceManager)
+	}
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	done := 0
+	for _, serviceManager := range serviceManagers {
+		serviceManager := serviceManager
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				batchResults, err := getRepositoryListBySha1s(serviceManager, batches[i])
+				mutex.Lock()
+				if err != nil {
+					log.Error(fmt.Sprintf("Could not find repositories for %d checksums: %s", len(batches[i]), err.Error()))
+				} else {
+					results[i] = batchResults
+					succeeded[i] = true
+					done += len(batches[i])
+					log.Info(fmt.Sprintf("Looked up the repositories of %d/%d checksums", done, len(uncached)))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	var failed []string
+	for i, batchResults := range results {
+		if succeeded[i] {
+			gb.cacheChecksumResults(batches[i], batchResults)
+		} else {
+			failed = append(failed, batches[i]...)
+		}
+	}
+	for _, batchResults := range append([][]Result{cachedResults}, results...) {
+		for _, result := range batchResults {
+			binaryNode := gb.graphCreateBinaryNode(result.ActualSha1)
+			if _, ok := binaryNode.properties["name"]; !ok && result.Name != "" {
+				binaryNode.properties["name"] = result.Name
+			}
+			if result.Sha256 != "" {
+				binaryNode.properties["sha256"] = result.Sha256
+			}
+			gb.linkBinToRepos(result.ActualSha1, result.Repo)
+		}
+	}
+	return failed, nil
+}
+
+// Returns the cached repositories of the checksums, and the checksums missing from the cache.
+// Results cached before the sha256 checksum was looked up are missing, since the Xray summaries and release bundles need it.
+func (gb *GraphBuilder) getCachedChecksumResults(checksums []string) ([]Result, []string) {
+	if gb.cache == nil {
+		return nil, checksums
+	}
+	var cachedResults []Result
+	var uncached []string
+	for _, sha1 := range checksums {
+		var results []Result
+		if gb.cache.get(cacheChecksums, sha1, gb.builderConfig.cache.checksumTTL, &results) && hasSha256(results) {
+			cachedResults = append(cachedResults, results...)
+		} else {
+			uncached = append(uncached, sha1)
+		}
+	}
+	if len(uncached) < len(checksums) {
+		log.Info(fmt.Sprintf("Found the repositories of %d/%d checksums in the cache", len(checksums)-len(uncached), len(checksums)))
+	}
+	return cachedResults, uncached
+}
+
+func hasSha256(results []Result) bool {
+	for _, result := range results {
+		if result.Sha256 == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Caches the results of each checksum, including checksums not found in any repository.
+func (gb *GraphBuilder) cacheChecksumResults(sha1s []string, results []Result) {
+	if gb.cache == nil {
+		return
+	}
+	resultsBySha1 := make(map[string][]Result, len(sha1s))
+	for _, sha1 := range sha1s {
+		resultsBySha1[sha1] = []Result{}
+	}
+	for _, result := range results {
+		if _, ok := resultsBySha1[result.ActualSha1]; ok {
+			resultsBySha1[result.ActualSha1] = append(resultsBySha1[result.ActualSha1], result)
+		}
+	}
+	for _, sha1 := range sha1s {
+		gb.cache.put(cacheChecksums, sha1, resultsBySha1[sha1])
+	}
+}
+
+func getRepositoryListBySha1s(serviceManager artifactory.ArtifactoryServicesManager, sha1s []string) ([]Result, error) {
+	return getAqlResults(serviceManager, createAqlQueryForChecksumRepositories(sha1s))
+}
+
+// Runs the AQL query, and returns the items found.
+func getAqlResults(serviceManager artifactory.ArtifactoryServicesManager, query string) ([]Result, error) {
+	stream, err := serviceManager.Aql(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, nil
+	}
+	parsedResults := Sha1AqlResults{}
+	if err = json.Unmarshal(content, &parsedResults); err != nil {
+		return nil, err
+	}
+	return parsedResults.Results, nil
+}
+
+func createAqlQueryForChecksumRepositories(sha1s []string) string {
+	var criteria []string
+	for _, sha1 := range sha1s {
+		value, _ := json.Marshal(sha1)
+		criteria = append(criteria, fmt.Sprintf(`{"actual_sha1": %s}`, value))
+	}
+	return fmt.Sprintf(`items.find({"$or": [%s]}).include("repo", "path", "name", "actual_sha1", "sha256")`, strings.Join(criteria, ", "))
+}
+
+// Splits the values into chunks of up to size values. A size which is not positive keeps all the values in a single chunk.
+func chunkStrings(values []string, size int) [][]string {
+	if size <= 0 {
+		size = len(values)
+	}
+	var chunks [][]string
+	for start := 0; start < len(values); start += size {
+		end := start + size
+		if end > len(values) {
+			end = len(values)
+		}
+		chunks = append(chunks, values[start:end])
+	}
+	return chunks
+}
+
+func getChecksumLookupFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name:         "aql-batch-size",
+			Description:  "[Default: 500] Number of binary checksums looked up in a single AQL query.",
+			DefaultValue: "500",
+		},
+		components.StringFlag{
+			Name:         "aql-threads",
+			Description:  "[Default: 3] Number of AQL queries running concurrently.",
+			DefaultValue: "3",
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var testChecksumLookup = &checksumLookupConfig{batchSize: 100, threads: 1}
+
+func TestChecksumSet(t *testing.T) {
+	checksums := newChecksumSet()
+	checksums.add("sha2")
+	checksums.add("sha1")
+	checksums.add("sha2")
+	assert.Equal(t, []string{"sha2", "sha1"}, checksums.values)
+}
+
+func TestChunkStrings(t *testing.T) {
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, chunkStrings([]string{"a", "b", "c"}, 2))
+	assert.Empty(t, chunkStrings(nil, 2))
+	assert.Equal(t, [][]string{{"a", "b", "c"}}, chunkStrings([]string{"a", "b", "c"}, 0))
+}
+
+func TestLinkChecksumsToReposInBatches(t *testing.T) {
+	sha1RegExp := regexp.MustCompile(`"actual_sha1": "(\w+)"`)
+	var queries int32
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		atomic.AddInt32(&queries, 1)
+		var results []string
+		for _, match := range sha1RegExp.FindAllStringSubmatch(string(body), -1) {
+			if match[1] == "sha5" {
+				// Not stored in any repository.
+				continue
+			}
+			results = append(results, fmt.Sprintf(`{"repo": "remote1-cache", "path": "a/b", "name": "%s.jar", "actual_sha1": "%s"}`, match[1], match[1]))
+		}
+		_, _ = w.Write([]byte(`{"results": [` + strings.Join(results, ", ") + `]}`))
+	}, &graphBuilderConfig{checksumLookup: &checksumLookupConfig{batchSize: 2, threads: 2}})
+	gb.allRepos["remote1"] = &CommonRepositoryDetails{Key: "remote1", Rclass: "remote"}
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, false, false, false)
+
+	failed, err := gb.linkChecksumsToRepos([]string{"sha1", "sha2", "sha3", "sha4", "sha5"})
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&queries))
+	assert.Equal(t, 4, gb.graph.edgeCounts()[relStores])
+	assert.Equal(t, "sha1.jar", gb.graph.getNode(labelBinary, "sha1").properties["name"])
+	assert.Nil(t, gb.graph.getNode(labelBinary, "sha5"))
+}
+
+func TestLinkChecksumsToReposSkipsFailedBatches(t *testing.T) {
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), `"sha1"`) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": [{"repo": "local1", "actual_sha1": "sha2"}]}`))
+	}, &graphBuilderConfig{checksumLookup: &checksumLookupConfig{batchSize: 1, threads: 1}})
+	gb.allRepos["local1"] = &CommonRepositoryDetails{Key: "local1", Rclass: "local"}
+	gb.graphCreateRepoNode("local1", "LOCAL", false, false, false, false)
+
+	failed, err := gb.linkChecksumsToRepos([]string{"sha1", "sha2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sha1"}, failed)
+	assert.Equal(t, map[string]int{relStores: 1}, gb.graph.edgeCounts())
+}
@@ -0,0 +1,284 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var cypherParamRegExp = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// A Cypher query with its parameters. Values are never formatted into the query itself,
+// so that names containing quotes can't break or inject into the query.
+type cypherCommand struct {
+	query        string
+	params       map[string]interface{}
+	relationship bool
+}
+
+// Returns the command as a standalone Cypher statement, with the parameters replaced by escaped literals.
+// Used for the script written to a file or stdout.
+func (cc *cypherCommand) render() string {
+	return cypherParamRegExp.ReplaceAllStringFunc(cc.query, func(param string) string {
+		value, ok := cc.params[param[1:]]
+		if !ok {
+			return param
+		}
+		return cypherLiteral(value)
+	})
+}
+
+func cypherLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return `"` + escapeCypherString(v) + `"`
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = cypherLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		var entries []string
+		for _, name := range sortedPropertyNames(v) {
+			entries = append(entries, cypherName(name)+": "+cypherLiteral(v[name]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return `"` + escapeCypherString(fmt.Sprint(v)) + `"`
+	}
+}
+
+var cypherIdentifierRegExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Returns the name as a Cypher identifier, quoted with backticks if needed.
+func cypherName(name string) string {
+	if cypherIdentifierRegExp.MatchString(name) {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func escapeCypherString(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				sb.WriteString(fmt.Sprintf(`\u%04X`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Identifies the graph elements written to neo4j by a run. Nodes are merged by their key properties within the scope,
+// so that the graphs of several servers can share a database, and are pruned by the run ID.
+type graphWriteTags struct {
+	scope string
+	runId string
+}
+
+// Returns the commands creating the graph: the nodes first, and then the relationships between them.
+// Labels, relationship types and property names come from the graph model and are never user input.
+// Without tags, the commands are not scoped.
+func getCypherCommands(graph *graphModel, tags *graphWriteTags) []cypherCommand {
+	var commands []cypherCommand
+	for _, node := range graph.nodes {
+		commands = append(commands, nodeCommand(node, tags))
+	}
+	for _, edge := range graph.edges {
+		commands = append(commands, edgeCommand(edge, tags))
+	}
+	return commands
+}
+
+// Returns the graph as a Cypher script.
+func getCypherScript(graph *graphModel) string {
+	commands := getCypherCommands(graph, nil)
+	statements := make([]string, len(commands))
+	for i := range commands {
+		statements[i] = commands[i].render()
+	}
+	return strings.Join(statements, "\n")
+}
+
+func nodeCommand(node *graphNode, tags *graphWriteTags) cypherCommand {
+	params := map[string]interface{}{}
+	query := fmt.Sprintf("MERGE (n:%s {%s})", node.label, keysPattern(node, "", tags, params))
+	var assignments []string
+	if otherProperties := node.otherProperties(); len(otherProperties) > 0 {
+		assignments = append(assignments, "n += $props")
+		params["props"] = otherProperties
+	}
+	assignments = append(assignments, runIdAssignment("n", tags, params)...)
+	if len(assignments) > 0 {
+		query += " SET " + strings.Join(assignments, ", ")
+	}
+	return cypherCommand{query: query + ";", params: params}
+}
+
+func edgeCommand(edge *graphEdge, tags *graphWriteTags) cypherCommand {
+	params := map[string]interface{}{}
+	query := fmt.Sprintf("MATCH (a:%s {%s}), (b:%s {%s}) MERGE (a)-[r:%s]->(b)", edge.from.label, keysPattern(edge.from, "from_", tags, params),
+		edge.to.label, keysPattern(edge.to, "to_", tags, params), edge.relType)
+	var assignments []string
+	if len(edge.properties) > 0 {
+		assignments = append(assignments, "r += $props")
+		params["props"] = edge.properties
+	}
+	assignments = append(assignments, runIdAssignment("r", tags, params)...)
+	if len(assignments) > 0 {
+		query += " SET " + strings.Join(assignments, ", ")
+	}
+	return cypherCommand{query: query + ";", params: params, relationship: true}
+}
+
+// Returns the pattern matching the node key properties and scope, and adds their values to the params.
+func keysPattern(node *graphNode, paramPrefix string, tags *graphWriteTags, params map[string]interface{}) string {
+	var matches []string
+	for _, key := range node.keys {
+		matches = append(matches, fmt.Sprintf("%s: $%s%s", cypherName(key), paramPrefix, key))
+		params[paramPrefix+key] = node.properties[key]
+	}
+	if tags != nil {
+		matches = append(matches, "scope: $scope")
+		params["scope"] = tags.scope
+	}
+	return strings.Join(matches, ", ")
+}
+
+// Returns the assignment tagging the element with the run ID, if any.
+func runIdAssignment(variable string, tags *graphWriteTags, params map[string]interface{}) []string {
+	if tags == nil {
+		return nil
+	}
+	params["run_id"] = tags.runId
+	return []string{variable + ".run_id = $run_id"}
+}
+
+// Makes the nodes of a label unique by their key properties. The constraint requires the enterprise edition,
+// so the index is created instead if the constraint can't be, and still avoids full scans when merging and matching.
+type schemaCommand struct {
+	label      string
+	constraint string
+	index      string
+	// Indexes the scope when writing with tags, for clearing and pruning the scope.
+	scopeIndex string
+}
+
+// Returns the schema commands of the node labels in the graph, sorted by label. Nodes are merged within their scope,
+// so the scope is part of the key when writing with tags. The commands do nothing if the schema already exists.
+func getSchemaCommands(graph *graphModel, tags *graphWriteTags) []schemaCommand {
+	keysByLabel := map[string][]string{}
+	var labels []string
+	for _, node := range graph.nodes {
+		if _, ok := keysByLabel[node.label]; !ok {
+			keysByLabel[node.label] = node.keys
+			labels = append(labels, node.label)
+		}
+	}
+	sort.Strings(labels)
+	var commands []schemaCommand
+	for _, label := range labels {
+		var properties []string
+		for _, key := range keysByLabel[label] {
+			properties = append(properties, "n."+cypherName(key))
+		}
+		if tags != nil {
+			properties = append(properties, "n.scope")
+		}
+		name := "stechhelm_" + strings.ToLower(label) + "_key"
+		command := schemaCommand{
+			label: label,
+			constraint: fmt.Sprintf("CREATE CONSTRAINT %s IF NOT EXISTS FOR (n:%s) REQUIRE (%s) IS NODE KEY", name, label,
+				strings.Join(properties, ", ")),
+			// The fallback index has its own name, so that it doesn't take the name of the constraint.
+			index: fmt.Sprintf("CREATE INDEX %s_idx IF NOT EXISTS FOR (n:%s) ON (%s)", name, label, strings.Join(properties, ", ")),
+		}
+		if tags != nil {
+			command.scopeIndex = fmt.Sprintf("CREATE INDEX stechhelm_%s_scope IF NOT EXISTS FOR (n:%s) ON (n.scope)", strings.ToLower(label), label)
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// Commands sharing the same query, written together as rows of a single UNWIND query.
+type cypherBatch struct {
+	query        string
+	relationship bool
+	rows         []map[string]interface{}
+}
+
+// Groups the commands by their query. Node batches come before relationship batches, so that the nodes
+// exist when relationships are matched. Otherwise, batches keep the order in which their queries first appeared.
+func groupCommands(commands []cypherCommand) []*cypherBatch {
+	var batches []*cypherBatch
+	batchByQuery := map[string]*cypherBatch{}
+	for _, command := range commands {
+		batch, ok := batchByQuery[command.query]
+		if !ok {
+			batch = &cypherBatch{query: command.query, relationship: command.relationship}
+			batchByQuery[command.query] = batch
+			batches = append(batches, batch)
+		}
+		row := command.params
+		if row == nil {
+			row = map[string]interface{}{}
+		}
+		batch.rows = append(batch.rows, row)
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		return !batches[i].relationship && batches[j].relationship
+	})
+	return batches
+}
+
+// Returns the batch query, which runs the command query for each of the rows in the $rows parameter.
+func (cb *cypherBatch) unwindQuery() string {
+	query := strings.TrimSuffix(strings.TrimSpace(cb.query), ";")
+	return "UNWIND $rows AS row " + cypherParamRegExp.ReplaceAllString(query, "row.$1")
+}
+
+// Splits the rows into chunks of up to size rows. A size which is not positive keeps all the rows in a single chunk.
+func chunkRows(rows []map[string]interface{}, size int) [][]map[string]interface{} {
+	if size <= 0 {
+		size = len(rows)
+	}
+	var chunks [][]map[string]interface{}
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunks = append(chunks, rows[start:end])
+	}
+	return chunks
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCypherCommandRender(t *testing.T) {
+	command := cypherCommand{
+		query:  `MERGE (build:Build {name: $name, number: $number, count: $count, is_safe: $is_safe, other: $missing});`,
+		params: map[string]interface{}{"name": `evil"}) DETACH DELETE (n) //`, "number": "1\\2\n", "count": 3, "is_safe": true},
+	}
+	assert.Equal(t, `MERGE (build:Build {name: "evil\"}) DETACH DELETE (n) //", number: "1\\2\n", count: 3, is_safe: true, other: $missing});`,
+		command.render())
+}
+
+func TestEscapeCypherString(t *testing.T) {
+	var inputTestCase = []struct {
+		input    string
+		expected string
+	}{
+		{"plain-name", "plain-name"},
+		{`a"b`, `a\"b`},
+		{`a'b`, `a\'b`},
+		{`a\b`, `a\\b`},
+		{"a\tb\r\n", `a\tb\r\n`},
+		{"a\x00b", `a\u0000b`},
+		{"ünïcode", "ünïcode"},
+	}
+	for _, testCase := range inputTestCase {
+		assert.Equal(t, testCase.expected, escapeCypherString(testCase.input))
+	}
+}
+
+func TestGraphCommandsAreParameterized(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	buildName := `build"name`
+	gb.graphCreateRelationshipBuildToArtifact(buildName, "1", "sha1")
+	commands := getCypherCommands(gb.graph, nil)
+	for _, command := range commands {
+		assert.NotContains(t, command.query, buildName)
+	}
+	assert.Equal(t, buildName, commands[0].params["name"])
+	assert.Equal(t, `MERGE (n:Build {name: "build\"name", number: "1"});`, commands[0].render())
+}
+
+func TestGetCypherScript(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, true, false, true)
+	assert.Equal(t, `MERGE (n:RepoREMOTE {name: "remote1"}) SET n += {is_exc: false, is_inc: true, is_priority: false, is_xray: true, type: "REMOTE"};
+MERGE (n:Attacker {name: "attacker"});
+MATCH (a:Attacker {name: "attacker"}), (b:RepoREMOTE {name: "remote1"}) MERGE (a)-[r:ATTACKS]->(b);`, getCypherScript(gb.graph))
+}
+
+func TestGroupCommands(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRelationshipBuildToArtifact("build1", "1", "sha1")
+	gb.graphCreateRelationshipBuildToArtifact("build1", "1", "sha2")
+	gb.graphCreateRepoNode("local1", "LOCAL", false, false, false, false)
+	gb.graphCreateRelationshipBinaryToRepo("sha1", "local1")
+
+	batches := groupCommands(getCypherCommands(gb.graph, nil))
+	var queries []string
+	var rowCounts []int
+	for _, batch := range batches {
+		queries = append(queries, batch.unwindQuery())
+		rowCounts = append(rowCounts, len(batch.rows))
+	}
+	assert.Equal(t, []string{
+		`UNWIND $rows AS row MERGE (n:Build {name: row.name, number: row.number})`,
+		`UNWIND $rows AS row MERGE (n:Binary {sha1: row.sha1})`,
+		`UNWIND $rows AS row MERGE (n:RepoLOCAL {name: row.name}) SET n += row.props`,
+		`UNWIND $rows AS row MATCH (a:Build {name: row.from_name, number: row.from_number}), (b:Binary {sha1: row.to_sha1}) MERGE (a)-[r:PRODUCE]->(b)`,
+		`UNWIND $rows AS row MATCH (a:RepoLOCAL {name: row.from_name}), (b:Binary {sha1: row.to_sha1}) MERGE (a)-[r:STORES]->(b)`,
+	}, queries)
+	assert.Equal(t, []int{1, 2, 1, 2, 1}, rowCounts)
+}
+
+func TestChunkRows(t *testing.T) {
+	rows := make([]map[string]interface{}, 5)
+	chunks := chunkRows(rows, 2)
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[2], 1)
+	assert.Len(t, chunkRows(rows, 5), 1)
+	assert.Empty(t, chunkRows(nil, 5))
+	assert.Len(t, chunkRows(rows, 0), 1)
+}
+
+func TestTaggedCypherCommands(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateAttackerNode()
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, false, false, false)
+	commands := getCypherCommands(gb.graph, &graphWriteTags{scope: "http://rt", runId: "run1"})
+	var queries []string
+	for _, command := range commands {
+		queries = append(queries, command.query)
+		assert.Equal(t, "http://rt", command.params["scope"])
+		assert.Equal(t, "run1", command.params["run_id"])
+	}
+	assert.Equal(t, []string{
+		`MERGE (n:Attacker {name: $name, scope: $scope}) SET n.run_id = $run_id;`,
+		`MERGE (n:RepoREMOTE {name: $name, scope: $scope}) SET n += $props, n.run_id = $run_id;`,
+		`MATCH (a:Attacker {name: $from_name, scope: $scope}), (b:RepoREMOTE {name: $to_name, scope: $scope}) MERGE (a)-[r:ATTACKS]->(b) SET r.run_id = $run_id;`,
+	}, queries)
+}
+
+func TestGetSchemaCommands(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRelationshipDependencyToBuild("build1", "1", "sha1")
+	gb.graphCreateRelationshipDependencyToBuild("build1", "2", "sha2")
+	gb.graphCreateRepoNode("local1", "LOCAL", false, false, false, false)
+
+	commands := getSchemaCommands(gb.graph, &graphWriteTags{scope: "https://acme.jfrog.io/artifactory", runId: "run1"})
+	assert.Equal(t, []schemaCommand{
+		{label: labelBinary, constraint: "CREATE CONSTRAINT stechhelm_binary_key IF NOT EXISTS FOR (n:Binary) REQUIRE (n.sha1, n.scope) IS NODE KEY",
+			index:      "CREATE INDEX stechhelm_binary_key_idx IF NOT EXISTS FOR (n:Binary) ON (n.sha1, n.scope)",
+			scopeIndex: "CREATE INDEX stechhelm_binary_scope IF NOT EXISTS FOR (n:Binary) ON (n.scope)"},
+		{label: labelBuild, constraint: "CREATE CONSTRAINT stechhelm_build_key IF NOT EXISTS FOR (n:Build) REQUIRE (n.name, n.number, n.scope) IS NODE KEY",
+			index:      "CREATE INDEX stechhelm_build_key_idx IF NOT EXISTS FOR (n:Build) ON (n.name, n.number, n.scope)",
+			scopeIndex: "CREATE INDEX stechhelm_build_scope IF NOT EXISTS FOR (n:Build) ON (n.scope)"},
+		{label: labelRepoLocal, constraint: "CREATE CONSTRAINT stechhelm_repolocal_key IF NOT EXISTS FOR (n:RepoLOCAL) REQUIRE (n.name, n.scope) IS NODE KEY",
+			index:      "CREATE INDEX stechhelm_repolocal_key_idx IF NOT EXISTS FOR (n:RepoLOCAL) ON (n.name, n.scope)",
+			scopeIndex: "CREATE INDEX stechhelm_repolocal_scope IF NOT EXISTS FOR (n:RepoLOCAL) ON (n.scope)"},
+	}, commands)
+
+	commands = getSchemaCommands(gb.graph, nil)
+	assert.Equal(t, "CREATE INDEX stechhelm_binary_key_idx IF NOT EXISTS FOR (n:Binary) ON (n.sha1)", commands[0].index)
+	assert.Empty(t, commands[0].scopeIndex)
+}
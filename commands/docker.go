@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"github.com/jfrog/jfrog-client-go/utils/errorutils"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const dockerManifestName = "manifest.json"
+
+// Package types of the repositories storing images as manifests and layers.
+var dockerPackageTypes = []string{"docker", "oci"}
+
+// An image manifest, as stored by Artifactory in the manifest.json file of each image tag.
+type dockerManifest struct {
+	MediaType string             `json:"mediaType"`
+	Config    dockerDescriptor   `json:"config"`
+	Layers    []dockerDescriptor `json:"layers"`
+}
+
+type dockerDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// An image found in a repository, with its layers digests in order.
+type dockerImage struct {
+	node   *graphNode
+	layers []string
+	// Whether the image was pulled through a remote repository.
+	remote bool
+}
+
+// Adds the images stored in docker and OCI repositories, linked to their layers.
+// Images pulled through remote repositories are linked as base images to the images built on top of them,
+// and images produced by builds are linked to the builds, which depend on their base images.
+// The manifests are found in batches of repositories, and failed batches are logged and skipped.
+func (gb *GraphBuilder) createDockerImagesGraphRelations() {
+	var results []Result
+	for _, batch := range chunkStrings(gb.getDockerRepos(), gb.builderConfig.checksumLookup.batchSize) {
+		batchResults, err := getAqlResults(gb.serviceManager, createAqlQueryForDockerManifests(batch))
+		if err != nil {
+			log.Error(fmt.Sprintf("Could not find the docker manifests of %d repositories: %s", len(batch), err.Error()))
+			continue
+		}
+		results = append(results, batchResults...)
+	}
+	if len(results) == 0 {
+		return
+	}
+	log.Info(fmt.Sprintf("Handling %d docker manifests", len(results)))
+	images := map[string]*dockerImage{}
+	var digests []string
+	imageBySha1 := map[string]*dockerImage{}
+	for _, result := range results {
+		// The manifest checksum is the image digest, and the key of the cached manifest.
+		if result.Sha256 == "" {
+			log.Debug(fmt.Sprintf("The docker manifest %s/%s has no sha256 checksum, skipping it", result.Repo, result.Path))
+			continue
+		}
+		manifest, err := gb.getDockerManifest(&result)
+		if err != nil {
+			log.Error(fmt.Sprintf("Could not read the docker manifest %s/%s: %s", result.Repo, result.Path, err.Error()))
+			continue
+		}
+		digest := "sha256:" + result.Sha256
+		image, ok := images[digest]
+		if !ok {
+			image = gb.handleDockerManifest(digest, manifest)
+			images[digest] = image
+			digests = append(digests, digest)
+		}
+		gb.addDockerImageTag(image.node, result.Path)
+		if repoConfig, ok := gb.allRepos[strings.TrimSuffix(result.Repo, "-cache")]; ok && strings.EqualFold(repoConfig.Rclass, "remote") {
+			image.remote = true
+		}
+		gb.linkToRepos(result.Repo, func(repoName string) {
+			if repoNode := gb.getRepoNode(repoName); repoNode != nil {
+				gb.graph.addEdge(relStores, repoNode, image.node, nil)
+			}
+		})
+		imageBySha1[result.ActualSha1] = image
+	}
+	baseImages := linkBaseImages(gb.graph, images, digests)
+	gb.linkDockerBuilds(imageBySha1, baseImages)
+}
+
+// Returns the docker and OCI repositories storing manifests: the local repositories and the caches of the remote repositories.
+func (gb *GraphBuilder) getDockerRepos() []string {
+	var repos []string
+	for key, repoConfig := range gb.allRepos {
+		if !containsString(dockerPackageTypes, strings.ToLower(repoConfig.PackageType)) {
+			continue
+		}
+		if strings.EqualFold(repoConfig.Rclass, "local") {
+			repos = append(repos, key)
+		} else if strings.EqualFold(repoConfig.Rclass, "remote") {
+			repos = append(repos, key+"-cache")
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+func createAqlQueryForDockerManifests(repos []string) string {
+	var criteria []string
+	for _, repo := range repos {
+		value, _ := json.Marshal(repo)
+		criteria = append(criteria, fmt.Sprintf(`{"repo": %s}`, value))
+	}
+	return fmt.Sprintf(`items.find({"name": "%s", "$or": [%s]}).include("repo", "path", "name", "actual_sha1", "sha256")`,
+		dockerManifestName, strings.Join(criteria, ", "))
+}
+
+// Reads the manifest from the cache, or downloads and caches it.
+// Manifests are addressed by their checksum, so they are cached without expiration.
+func (gb *GraphBuilder) getDockerManifest(result *Result) (*dockerManifest, error) {
+	manifest := &dockerManifest{}
+	if gb.cache.get(cacheDockerManifests, result.Sha256, 0, manifest) {
+		return manifest, nil
+	}
+	var segments []string
+	for _, segment := range strings.Split(path.Join(result.Repo, result.Path, result.Name), "/") {
+		segments = append(segments, url.PathEscape(segment))
+	}
+	resp, respBody, _, err := gb.serviceManager.Client().SendGet(gb.baseUrl+strings.Join(segments, "/"), true, &gb.clientDetails)
+	if err != nil {
+		return nil, err
+	}
+	if err = errorutils.CheckResponseStatus(resp, http.StatusOK); err != nil {
+		return nil, errorutils.GenerateResponseError(resp.Status, clientutils.IndentJson(respBody))
+	}
+	if err = json.Unmarshal(respBody, manifest); err != nil {
+		return nil, err
+	}
+	gb.cache.put(cacheDockerManifests, result.Sha256, manifest)
+	return manifest, nil
+}
+
+// Creates the image node, linked to its layers. Layers keep their index in the image.
+func (gb *GraphBuilder) handleDockerManifest(digest string, manifest *dockerManifest) *dockerImage {
+	image := &dockerImage{node: gb.graph.addNode(labelImage, map[string]interface{}{"digest": digest}, "digest")}
+	for i, layer := range manifest.Layers {
+		layerNode := gb.graph.addNode(labelLayer, map[string]interface{}{"digest": layer.Digest, "size": layer.Size}, "digest")
+		gb.graph.addEdge(relHasLayer, image.node, layerNode, map[string]interface{}{"index": i})
+		image.layers = append(image.layers, layer.Digest)
+	}
+	return image
+}
+
+// Adds the tag of the image, from the path of its manifest, e.g. library/ubuntu/20.04 is ubuntu:20.04.
+func (gb *GraphBuilder) addDockerImageTag(imageNode *graphNode, manifestPath string) {
+	name, tag := path.Split(manifestPath)
+	name = strings.TrimPrefix(strings.TrimSuffix(name, "/"), "library/")
+	if _, ok := imageNode.properties["name"]; !ok {
+		imageNode.properties["name"] = name
+	}
+	tags, _ := imageNode.properties["tags"].([]string)
+	tags = appendUnique(tags, name+":"+tag)
+	sort.Strings(tags)
+	imageNode.properties["tags"] = tags
+}
+
+// Links each image to its base image: the image pulled through a remote repository with the most layers,
+// whose layers are the first layers of the image. Returns the base image of each image.
+func linkBaseImages(graph *graphModel, images map[string]*dockerImage, digests []string) map[*dockerImage]*dockerImage {
+	remoteByLayers := map[string]*dockerImage{}
+	for _, digest := range digests {
+		if image := images[digest]; image.remote && len(image.layers) > 0 {
+			remoteByLayers[strings.Join(image.layers, ",")] = image
+		}
+	}
+	baseImages := map[*dockerImage]*dockerImage{}
+	for _, digest := range digests {
+		image := images[digest]
+		for count := len(image.layers) - 1; count > 0; count-- {
+			if base, ok := remoteByLayers[strings.Join(image.layers[:count], ",")]; ok {
+				graph.addEdge(relBaseImageFor, base.node, image.node, nil)
+				baseImages[image] = base
+				break
+			}
+		}
+	}
+	return baseImages
+}
+
+// Links the builds to the images they produced, by the checksum of the manifest in the build artifacts.
+// The base image of a produced image is a dependency of the build.
+func (gb *GraphBuilder) linkDockerBuilds(imageBySha1 map[string]*dockerImage, baseImages map[*dockerImage]*dockerImage) {
+	for _, edge := range gb.graph.edges {
+		if edge.relType != relProduce || edge.to.label != labelBinary {
+			continue
+		}
+		image, ok := imageBySha1[fmt.Sprint(edge.to.properties["sha1"])]
+		if !ok {
+			continue
+		}
+		gb.graph.addEdge(relProduce, edge.from, image.node, nil)
+		if base, ok := baseImages[image]; ok {
+			gb.graph.addEdge(relDependencyFor, base.node, edge.from, nil)
+		}
+	}
+}
+
+func getDockerImagesFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name: "docker-images",
+			Description: "[Default: false] Set to true to add the images stored in docker and OCI repositories to the graph, " +
+				"linked to their layers, to the base images pulled through remote repositories and to the builds producing them.",
+			DefaultValue: false,
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateDockerImagesGraphRelations(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{
+		"/api/search/aql": `{"results": [
+			{"repo": "dockerhub-cache", "path": "library/ubuntu/20.04", "name": "manifest.json", "actual_sha1": "sha1-base", "sha256": "base"},
+			{"repo": "docker-local", "path": "app/1.0", "name": "manifest.json", "actual_sha1": "sha1-app", "sha256": "app"},
+			{"repo": "docker-local", "path": "app/latest", "name": "manifest.json", "actual_sha1": "sha1-app", "sha256": "app"},
+			{"repo": "docker-local", "path": "legacy/1.0", "name": "manifest.json", "actual_sha1": "sha1-legacy"}]}`,
+		"/dockerhub-cache/library/ubuntu/20.04/manifest.json": `{"layers": [{"digest": "sha256:layer1", "size": 100}]}`,
+		"/docker-local/app/1.0/manifest.json":                 `{"layers": [{"digest": "sha256:layer1", "size": 100}, {"digest": "sha256:layer2", "size": 5}]}`,
+		"/docker-local/app/latest/manifest.json":              `{"layers": [{"digest": "sha256:layer1", "size": 100}, {"digest": "sha256:layer2", "size": 5}]}`,
+		"/docker-local/legacy/1.0/manifest.json":              `{"layers": [{"digest": "sha256:layer3", "size": 10}]}`,
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.allRepos["docker-local"] = &CommonRepositoryDetails{Key: "docker-local", Rclass: "local", PackageType: "docker"}
+	gb.allRepos["dockerhub"] = &CommonRepositoryDetails{Key: "dockerhub", Rclass: "remote", PackageType: "docker"}
+	gb.allRepos["npm-local"] = &CommonRepositoryDetails{Key: "npm-local", Rclass: "local", PackageType: "npm"}
+	gb.graphCreateRepoNode("docker-local", "LOCAL", false, false, false, false)
+	gb.graphCreateRepoNode("dockerhub", "REMOTE", false, false, false, false)
+	gb.graphCreateRelationshipBuildToArtifact("app", "1", "sha1-app")
+	assert.Equal(t, []string{"docker-local", "dockerhub-cache"}, gb.getDockerRepos())
+
+	gb.createDockerImagesGraphRelations()
+	base := gb.graph.getNode(labelImage, "sha256:base")
+	app := gb.graph.getNode(labelImage, "sha256:app")
+	build := gb.graph.getNode(labelBuild, "app", "1")
+	if assert.NotNil(t, base) && assert.NotNil(t, app) {
+		assert.Equal(t, "ubuntu", base.properties["name"])
+		assert.Equal(t, []string{"app:1.0", "app:latest"}, app.properties["tags"])
+		assert.Contains(t, gb.graph.edgeById, edgeId(relStores, gb.graph.getNode(labelRepoRemote, "dockerhub"), base))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relBaseImageFor, base, app))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relProduce, build, app))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relDependencyFor, base, build))
+	}
+	assert.Nil(t, gb.graph.getNode(labelImage, "sha256:"))
+	assert.Equal(t, 2, gb.graph.nodeCounts()[labelImage])
+	assert.Equal(t, map[string]int{relAttacks: 1, relStores: 2, relHasLayer: 3, relBaseImageFor: 1, relProduce: 2, relDependencyFor: 1},
+		gb.graph.edgeCounts())
+
+	paths := findAttackPaths(gb.graph, false)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, "attacker -[ATTACKS]-> dockerhub -[STORES]-> sha256:base -[DEPENDENCY_FOR]-> app/1", paths[0].String())
+	}
+}
+
+func TestCreateDockerImagesGraphRelationsSkipsFailedBatches(t *testing.T) {
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/search/aql":
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.Contains(string(body), "docker-local") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"results": [
+				{"repo": "dockerhub-cache", "path": "library/ubuntu/20.04", "name": "manifest.json", "actual_sha1": "sha1-base", "sha256": "base"}]}`))
+		case "/dockerhub-cache/library/ubuntu/20.04/manifest.json":
+			_, _ = w.Write([]byte(`{"layers": [{"digest": "sha256:layer1", "size": 100}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: &checksumLookupConfig{batchSize: 1, threads: 1}})
+	gb.allRepos["docker-local"] = &CommonRepositoryDetails{Key: "docker-local", Rclass: "local", PackageType: "docker"}
+	gb.allRepos["dockerhub"] = &CommonRepositoryDetails{Key: "dockerhub", Rclass: "remote", PackageType: "docker"}
+
+	gb.createDockerImagesGraphRelations()
+	assert.Equal(t, 1, gb.graph.nodeCounts()[labelImage])
+	assert.NotNil(t, gb.graph.getNode(labelImage, "sha256:base"))
+}
+
+func TestLinkBaseImages(t *testing.T) {
+	graph := newGraphModel()
+	newImage := func(digest string, remote bool, layers ...string) *dockerImage {
+		return &dockerImage{node: graph.addNode(labelImage, map[string]interface{}{"digest": digest}, "digest"), layers: layers, remote: remote}
+	}
+	images := map[string]*dockerImage{
+		"os":      newImage("os", true, "a"),
+		"runtime": newImage("runtime", true, "a", "b"),
+		"app":     newImage("app", false, "a", "b", "c"),
+		"local":   newImage("local", false, "a", "b", "c", "d"),
+	}
+	baseImages := linkBaseImages(graph, images, []string{"os", "runtime", "app", "local"})
+	assert.Equal(t, images["os"], baseImages[images["runtime"]])
+	assert.Equal(t, images["runtime"], baseImages[images["app"]])
+	// Only images pulled through remote repositories are base images.
+	assert.Equal(t, images["runtime"], baseImages[images["local"]])
+	assert.Nil(t, baseImages[images["os"]])
+}
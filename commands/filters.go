@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"regexp"
+	"strings"
+)
+
+var supportedRclasses = []string{"local", "remote", "virtual", "federated"}
+
+// Narrows the repositories handled by the audit and graph commands.
+// A nil filter matches every repository.
+type repoFilter struct {
+	includePatterns []*regexp.Regexp
+	excludePatterns []*regexp.Regexp
+	packageTypes    map[string]bool
+	rclasses        map[string]bool
+}
+
+func getRepoFilter(c *components.Context) (*repoFilter, error) {
+	return newRepoFilter(c.GetStringFlagValue("include-repos"), c.GetStringFlagValue("exclude-repos"),
+		c.GetStringFlagValue("package-type"), c.GetStringFlagValue("rclass"))
+}
+
+func newRepoFilter(includeRepos, excludeRepos, packageTypes, rclasses string) (*repoFilter, error) {
+	includePatterns, err := wildcardsToRegExps(splitFlagList(includeRepos))
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := wildcardsToRegExps(splitFlagList(excludeRepos))
+	if err != nil {
+		return nil, err
+	}
+	filter := &repoFilter{
+		includePatterns: includePatterns,
+		excludePatterns: excludePatterns,
+		packageTypes:    map[string]bool{},
+		rclasses:        map[string]bool{},
+	}
+	for _, packageType := range splitFlagList(packageTypes) {
+		filter.packageTypes[strings.ToLower(packageType)] = true
+	}
+	for _, rclass := range splitFlagList(rclasses) {
+		rclass = strings.ToLower(rclass)
+		if !containsString(supportedRclasses, rclass) {
+			return nil, fmt.Errorf("unsupported rclass '%s', expected one of: %s", rclass, strings.Join(supportedRclasses, ", "))
+		}
+		filter.rclasses[rclass] = true
+	}
+	return filter, nil
+}
+
+// Returns true if a repository with the given key, rclass and package type should be handled.
+func (rf *repoFilter) matches(key, rclass, packageType string) bool {
+	if rf == nil {
+		return true
+	}
+	if len(rf.rclasses) > 0 && !rf.rclasses[strings.ToLower(rclass)] {
+		return false
+	}
+	if len(rf.packageTypes) > 0 && !rf.packageTypes[strings.ToLower(packageType)] {
+		return false
+	}
+	if len(rf.includePatterns) > 0 && !matchesAny(rf.includePatterns, key) {
+		return false
+	}
+	return !matchesAny(rf.excludePatterns, key)
+}
+
+func (rf *repoFilter) matchesRepo(repo *CommonRepositoryDetails) bool {
+	return rf.matches(repo.Key, repo.Rclass, repo.PackageType)
+}
+
+// Splits a comma-separated flag value, dropping empty entries.
+func splitFlagList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func wildcardsToRegExps(patterns []string) ([]*regexp.Regexp, error) {
+	var regExps []*regexp.Regexp
+	for _, pattern := range patterns {
+		regExp, err := regexp.Compile(clientutils.WildcardPathToRegExp(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", pattern, err.Error())
+		}
+		regExps = append(regExps, regExp)
+	}
+	return regExps, nil
+}
+
+func matchesAny(regExps []*regexp.Regexp, value string) bool {
+	for _, regExp := range regExps {
+		if regExp.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func getRepoFilterFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name:        "include-repos",
+			Description: "Comma-separated list of wildcard patterns. Only repositories with a matching key are handled.",
+		},
+		components.StringFlag{
+			Name:        "exclude-repos",
+			Description: "Comma-separated list of wildcard patterns. Repositories with a matching key are skipped.",
+		},
+		components.StringFlag{
+			Name:        "package-type",
+			Description: "Comma-separated list of package types (e.g. npm,maven). Only repositories of these types are handled.",
+		},
+		components.StringFlag{
+			Name:        "rclass",
+			Description: "Comma-separated list of repository classes (local, remote, virtual, federated). Only repositories of these classes are handled.",
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRepoFilterMatches(t *testing.T) {
+	var inputTestCase = []struct {
+		name        string
+		include     string
+		exclude     string
+		packageType string
+		rclass      string
+		key         string
+		repoRclass  string
+		repoType    string
+		expected    bool
+	}{
+		{"no filters", "", "", "", "", "npm-local", "local", "npm", true},
+		{"include match", "npm-*", "", "", "", "npm-local", "local", "npm", true},
+		{"include no match", "maven-*", "", "", "", "npm-local", "local", "npm", false},
+		{"one of includes", "maven-*, npm-*", "", "", "", "npm-local", "local", "npm", true},
+		{"exclude match", "", "*-local", "", "", "npm-local", "local", "npm", false},
+		{"exclude wins over include", "npm-*", "*-local", "", "", "npm-local", "local", "npm", false},
+		{"dots are literal", "npm.local", "", "", "", "npm-local", "local", "npm", false},
+		{"package type match", "", "", "Maven,NPM", "", "npm-local", "local", "npm", true},
+		{"package type no match", "", "", "maven", "", "npm-local", "local", "npm", false},
+		{"rclass match", "", "", "", "remote,local", "npm-local", "LOCAL", "npm", true},
+		{"rclass no match", "", "", "", "virtual", "npm-local", "local", "npm", false},
+	}
+	for _, testCase := range inputTestCase {
+		t.Run(testCase.name, func(t *testing.T) {
+			filter, err := newRepoFilter(testCase.include, testCase.exclude, testCase.packageType, testCase.rclass)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, filter.matches(testCase.key, testCase.repoRclass, testCase.repoType))
+		})
+	}
+}
+
+func TestRepoFilterNilMatchesAll(t *testing.T) {
+	var filter *repoFilter
+	assert.True(t, filter.matches("any", "local", "npm"))
+}
+
+func TestNewRepoFilterErrors(t *testing.T) {
+	_, err := newRepoFilter("", "", "", "local,unknown")
+	assert.Error(t, err)
+	_, err = newRepoFilter("npm-(", "", "", "")
+	assert.Error(t, err)
+}
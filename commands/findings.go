@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A single failed audit rule of a repository.
+type finding struct {
+	Repo        string `json:"repo"`
+	Rclass      string `json:"rclass"`
+	PackageType string `json:"packageType"`
+	Rule        string `json:"rule"`
+	Reason      string `json:"reason"`
+}
+
+func (f *finding) id() string {
+	return strings.Join([]string{f.Repo, f.Rule, f.Reason}, "/")
+}
+
+// Returns the findings of the audit results, sorted.
+func getFindings(results []auditResult) []finding {
+	findings := []finding{}
+	for _, result := range results {
+		for _, failure := range result.Failures {
+			findings = append(findings, finding{
+				Repo:        result.Repo.Key,
+				Rclass:      strings.ToLower(result.Repo.Rclass),
+				PackageType: strings.ToLower(result.Repo.PackageType),
+				Rule:        failure.Rule,
+				Reason:      failure.Reason,
+			})
+		}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func sortFindings(findings []finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].id() < findings[j].id()
+	})
+}
+
+type findingsDiff struct {
+	New      []finding `json:"new"`
+	Resolved []finding `json:"resolved"`
+}
+
+func (fd *findingsDiff) isEmpty() bool {
+	return len(fd.New) == 0 && len(fd.Resolved) == 0
+}
+
+func diffFindings(previous, current []finding) findingsDiff {
+	diff := findingsDiff{New: []finding{}, Resolved: []finding{}}
+	previousIds := map[string]bool{}
+	for i := range previous {
+		previousIds[previous[i].id()] = true
+	}
+	currentIds := map[string]bool{}
+	for i := range current {
+		currentIds[current[i].id()] = true
+		if !previousIds[current[i].id()] {
+			diff.New = append(diff.New, current[i])
+		}
+	}
+	for i := range previous {
+		if !currentIds[previous[i].id()] {
+			diff.Resolved = append(diff.Resolved, previous[i])
+		}
+	}
+	return diff
+}
+
+// A change in the findings between two runs.
+type findingsChange struct {
+	Source        string    `json:"source"`
+	Timestamp     time.Time `json:"timestamp"`
+	TotalFindings int       `json:"totalFindings"`
+	findingsDiff
+}
+
+func logFindingsChange(change *findingsChange) {
+	log.Info(fmt.Sprintf("Findings changed: %d new, %d resolved, %d in total.", len(change.New), len(change.Resolved), change.TotalFindings))
+	for _, f := range change.New {
+		log.Info(fmt.Sprintf("New finding: %s (%s): %s", f.Repo, f.Rule, f.Reason))
+	}
+	for _, f := range change.Resolved {
+		log.Info(fmt.Sprintf("Resolved finding: %s (%s): %s", f.Repo, f.Rule, f.Reason))
+	}
+}
+
+// Notifies about the change between the findings stored in the state file and the current findings,
+// and stores the current findings in the state file.
+// Without a state file, all the current findings are considered new.
+func notifyFindingsChange(source string, notifier *notifier, stateFile string, current []finding) error {
+	var previous []finding
+	if stateFile != "" {
+		state, err := loadFindingsState(stateFile)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			previous = state.Findings
+		}
+	}
+	now := time.Now()
+	diff := diffFindings(previous, current)
+	if !diff.isEmpty() && notifier != nil {
+		change := &findingsChange{Source: source, Timestamp: now, TotalFindings: len(current), findingsDiff: diff}
+		logFindingsChange(change)
+		if err := notifier.notify(change); err != nil {
+			// The state is not updated, so that the change is notified again on the next run.
+			return err
+		}
+	}
+	if stateFile != "" {
+		return saveFindingsState(stateFile, &findingsState{Timestamp: now, Findings: current})
+	}
+	return nil
+}
+
+// The findings of the last run, persisted between runs.
+type findingsState struct {
+	Timestamp time.Time `json:"timestamp"`
+	Findings  []finding `json:"findings"`
+}
+
+// Returns the state stored in the file, or nil if the file does not exist.
+func loadFindingsState(path string) (*findingsState, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := &findingsState{}
+	if err = json.Unmarshal(content, state); err != nil {
+		return nil, errors.New("Failed parsing state file " + path + ": " + err.Error())
+	}
+	return state, nil
+}
+
+func saveFindingsState(path string, state *findingsState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+func getStateFileFlag() components.Flag {
+	return components.StringFlag{
+		Name:        "state-file",
+		Description: "Path to a file to keep the findings of the last run in, so that only new and resolved findings are reported.",
+	}
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiffFindings(t *testing.T) {
+	previous := getFindings([]auditResult{
+		{Repo: CommonRepositoryDetails{Key: "local1", Rclass: "local"}, Failures: []auditFailure{{ruleXrayIndex, "Not indexed."}}},
+		{Repo: CommonRepositoryDetails{Key: "remote1", Rclass: "remote"}, Failures: []auditFailure{{ruleIncludeExcludePatterns, "No patterns."}}},
+	})
+	current := getFindings([]auditResult{
+		{Repo: CommonRepositoryDetails{Key: "remote1", Rclass: "remote"}, Failures: []auditFailure{{ruleIncludeExcludePatterns, "No patterns."}}},
+		{Repo: CommonRepositoryDetails{Key: "local2", Rclass: "LOCAL", PackageType: "Go"}, Failures: []auditFailure{{rulePriorityResolution, "No priority."}}},
+	})
+
+	diff := diffFindings(previous, current)
+	assert.False(t, diff.isEmpty())
+	assert.Equal(t, []finding{{Repo: "local2", Rclass: "local", PackageType: "go", Rule: rulePriorityResolution, Reason: "No priority."}}, diff.New)
+	assert.Equal(t, []finding{{Repo: "local1", Rclass: "local", Rule: ruleXrayIndex, Reason: "Not indexed."}}, diff.Resolved)
+
+	diff = diffFindings(current, current)
+	assert.True(t, diff.isEmpty())
+
+	// Without previous findings, all findings are new.
+	diff = diffFindings(nil, current)
+	assert.Equal(t, current, diff.New)
+}
+
+func TestFindingsStateRoundTrip(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "stechhelm-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	stateFile := filepath.Join(tempDir, "state.json")
+
+	state, err := loadFindingsState(stateFile)
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	saved := &findingsState{
+		Timestamp: time.Unix(1700000000, 0).UTC(),
+		Findings:  []finding{{Repo: "local1", Rclass: "local", Rule: ruleXrayIndex, Reason: "Not indexed."}},
+	}
+	assert.NoError(t, saveFindingsState(stateFile, saved))
+	state, err = loadFindingsState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, saved, state)
+}
@@ -14,11 +14,9 @@ import (
 	"github.com/jfrog/jfrog-client-go/utils/errorutils"
 	"github.com/jfrog/jfrog-client-go/utils/io/httputils"
 	"github.com/jfrog/jfrog-client-go/utils/log"
-	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
-	"io"
-	"io/ioutil"
 	"net/http"
-	"reflect"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -49,35 +47,70 @@ func graphCmd(c *components.Context) error {
 	if err != nil {
 		return err
 	}
+	filter, err := getRepoFilter(c)
+	if err != nil {
+		return err
+	}
+	graphBuilder, err := newGraphBuilder(rtDetails, config, filter)
+	if err != nil {
+		return err
+	}
+	return graphBuilder.makeGraph()
+}
+
+func newGraphBuilder(rtDetails *config.ServerDetails, builderConfig *graphBuilderConfig, filter *repoFilter) (*GraphBuilder, error) {
 	graphBuilder := &GraphBuilder{
-		builderConfig:        config,
+		builderConfig:        builderConfig,
 		rtDetails:            rtDetails,
-		graphBuilderCommands: []string{},
-		cypherCommands:       make(map[string]bool),
+		repoFilter:           filter,
+		graph:                newGraphModel(),
 		repoToVirtualMapping: make(map[string]map[string]bool),
 		allRepos:             make(map[string]*CommonRepositoryDetails),
+		processedBuilds:      make(map[string]processedBuild),
+		repoHashes:           make(map[string]string),
+		runId:                time.Now().UTC().Format(time.RFC3339Nano),
 	}
+	var err error
 	graphBuilder.serviceManager, err = utils.CreateServiceManager(graphBuilder.rtDetails, -1, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	serviceDetails := graphBuilder.serviceManager.GetConfig().GetServiceDetails()
 	graphBuilder.clientDetails = serviceDetails.CreateHttpClientDetails()
 	graphBuilder.baseUrl = serviceDetails.GetUrl()
-	graphBuilder.graphAddCommand("MERGE (x:Attacker {name:\"attacker\"});")
-	return graphBuilder.makeGraph()
+	graphBuilder.cache, err = newServerCache(builderConfig.cache, rtDetails.ServerId)
+	if err != nil {
+		return nil, err
+	}
+	graphBuilder.summaryProvider, err = newSummaryProvider(builderConfig, rtDetails)
+	if err != nil {
+		return nil, err
+	}
+	graphBuilder.graphCreateAttackerNode()
+	return graphBuilder, nil
 }
 
 type GraphBuilder struct {
 	baseUrl              string
-	graphBuilderCommands []string
-	cypherCommands       map[string]bool
+	graph                *graphModel
 	builderConfig        *graphBuilderConfig
 	rtDetails            *config.ServerDetails
 	repoToVirtualMapping map[string]map[string]bool
 	clientDetails        httputils.HttpClientDetails
 	serviceManager       artifactory.ArtifactoryServicesManager
 	allRepos             map[string]*CommonRepositoryDetails
+	repoFilter           *repoFilter
+	findings             []finding
+	// The cache of Artifactory responses, or nil if disabled.
+	cache *fileCache
+	// The state of the last run in incremental mode, or nil when the whole graph is built.
+	runState        *graphRunState
+	processedBuilds map[string]processedBuild
+	repoHashes      map[string]string
+	// Tags the graph elements written to neo4j by this run.
+	runId string
+	// Provides the Xray summaries of the binaries, or nil if the graph is not enriched with Xray data.
+	summaryProvider summaryProvider
 }
 
 func getGraphBuilderConfig(c *components.Context) (*graphBuilderConfig, error) {
@@ -94,18 +127,104 @@ func getGraphBuilderConfig(c *components.Context) (*graphBuilderConfig, error) {
 	verbose := c.GetBoolFlagValue("verbose")
 	outToFile := c.GetBoolFlagValue("output-to-file")
 	outFilePath := c.GetStringFlagValue("output-file-path")
+	metricsFile := c.GetStringFlagValue("metrics-file")
+	outputFormats, err := getGraphOutputFormats(c)
+	if err != nil {
+		return nil, err
+	}
+	// Setting the output formats implies writing them to files.
+	outToFile = outToFile || len(outputFormats) > 0
+	if len(outputFormats) == 0 {
+		outputFormats = []string{formatCypher}
+	}
+	batchSize, err := strconv.Atoi(c.GetStringFlagValue("graph-batch-size"))
+	if err != nil || batchSize <= 0 {
+		return nil, errors.New("graph-batch-size must be a positive number")
+	}
+	notifier, err := getNotifier(c)
+	if err != nil {
+		return nil, err
+	}
+	builderConfig, err := getCollectorConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	incremental := c.GetBoolFlagValue("incremental")
+	if incremental && graphUrl == "" {
+		return nil, errors.New("incremental mode requires the neo4j connection details")
+	}
+	prune := c.GetBoolFlagValue("prune")
+	clear := c.GetBoolFlagValue("clear")
+	deleteUnscoped := c.GetBoolFlagValue("delete-unscoped")
+	if (prune || clear || deleteUnscoped) && graphUrl == "" {
+		return nil, errors.New("prune, clear and delete-unscoped require the neo4j connection details")
+	}
+	if prune && incremental {
+		return nil, errors.New("prune can't be used in incremental mode, since unchanged graph elements are not written again")
+	}
+	builderConfig.verbose = verbose
+	builderConfig.graphUrl = graphUrl
+	builderConfig.outToFile = outToFile
+	builderConfig.graphUser = graphUser
+	builderConfig.graphRealm = graphRealm
+	builderConfig.outFilePath = outFilePath
+	builderConfig.outputFormats = outputFormats
+	builderConfig.graphDatabase = graphDatabase
+	builderConfig.graphPassword = graphPassword
+	builderConfig.metricsFile = metricsFile
+	builderConfig.batchSize = batchSize
+	builderConfig.stateFile = c.GetStringFlagValue("state-file")
+	builderConfig.notifier = notifier
+	builderConfig.incremental = incremental
+	builderConfig.runStateFile = c.GetStringFlagValue("run-state-file")
+	builderConfig.prune = prune
+	builderConfig.clear = clear
+	builderConfig.deleteUnscoped = deleteUnscoped
+	builderConfig.xray = c.GetBoolFlagValue("xray")
+	builderConfig.xraySummariesFile = c.GetStringFlagValue("xray-summaries-file")
+	return builderConfig, nil
+}
+
+// Returns the configuration of collecting the graph from Artifactory, shared by the commands building the graph.
+func getCollectorConfig(c *components.Context) (*graphBuilderConfig, error) {
+	buildSelection, err := getBuildSelection(c)
+	if err != nil {
+		return nil, err
+	}
+	checksumLookup, err := getChecksumLookupConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := getCacheConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	upstreamTrust, err := getUpstreamTrust(c)
+	if err != nil {
+		return nil, err
+	}
 	return &graphBuilderConfig{
-		verbose:       verbose,
-		graphUrl:      graphUrl,
-		outToFile:     outToFile,
-		graphUser:     graphUser,
-		graphRealm:    graphRealm,
-		outFilePath:   outFilePath,
-		graphDatabase: graphDatabase,
-		graphPassword: graphPassword,
+		buildSelection: buildSelection,
+		checksumLookup: checksumLookup,
+		cache:          cache,
+		releaseBundles: c.GetBoolFlagValue("release-bundles"),
+		dockerImages:   c.GetBoolFlagValue("docker-images"),
+		upstreamTrust:  upstreamTrust,
 	}, nil
 }
 
+// Returns the flags of collecting the graph from Artifactory, shared by the commands building the graph.
+func getCollectorFlags() []components.Flag {
+	return joinFlagGroups([][]components.Flag{
+		getBuildSelectionFlags(),
+		getChecksumLookupFlags(),
+		getGraphCacheFlags(),
+		getReleaseBundleFlags(),
+		getDockerImagesFlags(),
+		getUpstreamTrustFlags(),
+	})
+}
+
 type graphBuilderConfig struct {
 	verbose       bool
 	outToFile     bool
@@ -114,12 +233,110 @@ type graphBuilderConfig struct {
 	graphPassword string
 	graphRealm    string
 	outFilePath   string
+	outputFormats []string
 	graphDatabase string
+	metricsFile   string
+	batchSize     int
+	stateFile     string
+	notifier      *notifier
+	// Selects the builds of each build name to include.
+	buildSelection *buildSelection
+	checksumLookup *checksumLookupConfig
+	cache          *cacheConfig
+	// Only collects the new builds and writes the changed graph elements, based on the state of the last run.
+	incremental  bool
+	runStateFile string
+	// Deletes the graph elements of the server which were not written by this run, after writing.
+	prune bool
+	// Deletes the graph elements of the server, before writing.
+	clear bool
+	// Deletes the nodes without a scope written by earlier versions, regardless of the server, before writing.
+	deleteUnscoped bool
+	// Enriches the binaries with Xray summaries, from Xray or from a file standing in for it.
+	xray              bool
+	xraySummariesFile string
+	// Adds the release bundles, linked to the binaries they contain and to the builds they were created from.
+	releaseBundles bool
+	// Adds the images of the docker and OCI repositories, linked to their layers, base images and builds.
+	dockerImages bool
+	// Decides which upstreams of the remote repositories are exposed to the attacker.
+	upstreamTrust *upstreamTrust
 }
 
 func (gb *GraphBuilder) makeGraph() error {
 	startTime := time.Now()
+	var runStatePath string
+	if gb.builderConfig.incremental {
+		var err error
+		runStatePath, err = getRunStatePath(gb.builderConfig, gb.rtDetails.ServerId)
+		if err != nil {
+			return err
+		}
+		if gb.builderConfig.clear {
+			log.Info("The graph is cleared, rebuilding the whole graph")
+		} else {
+			gb.runState = loadGraphRunState(runStatePath, gb.builderConfig)
+		}
+	}
+	err := gb.collectGraph()
+	if err != nil {
+		return err
+	}
+	collectionDuration := time.Since(startTime)
+	// Populate graph.
+	err = gb.populateGraphDb(runStatePath)
+	if err != nil {
+		log.Error("Failed connecting to graphDB: " + err.Error())
+	}
+	// Output results. The graph of an incremental run only has the new builds, so it is not exported.
+	partial := gb.runState != nil
+	if partial && (gb.builderConfig.outToFile || gb.builderConfig.verbose || gb.builderConfig.metricsFile != "") {
+		log.Warn("The graph of an incremental run only has the new builds, skipping the output files, metrics and graph commands")
+	}
+	if !partial {
+		err = gb.outputResults()
+		if err != nil {
+			return err
+		}
+	}
+	endTime := time.Now()
+	log.Info(fmt.Sprintf("Graph creation took: %f seconds", endTime.Sub(startTime).Seconds()))
+	if gb.builderConfig.metricsFile != "" && !partial {
+		err = writePrometheusFile(gb.builderConfig.metricsFile, getGraphMetrics(gb.graph, collectionDuration, endTime.Sub(startTime), endTime))
+		if err != nil {
+			return err
+		}
+	}
+	if gb.builderConfig.notifier != nil || gb.builderConfig.stateFile != "" {
+		sortFindings(gb.findings)
+		return notifyFindingsChange("graph", gb.builderConfig.notifier, gb.builderConfig.stateFile, gb.findings)
+	}
+	return nil
+}
+
+// Writes the graph to neo4j. In incremental mode, only the changed graph elements are written,
+// and the run state is saved once they were written successfully.
+func (gb *GraphBuilder) populateGraphDb(runStatePath string) error {
+	if !gb.builderConfig.incremental {
+		return populateGraphDb(gb.builderConfig, gb.graph, gb.writeTags())
+	}
+	nextRunState := gb.nextRunState()
+	changedGraph := getChangedGraph(gb.graph, gb.runState, nextRunState)
+	log.Info(fmt.Sprintf("%d repositories changed, writing %d/%d nodes and %d/%d relationships", len(gb.changedRepos()),
+		len(changedGraph.nodes), len(gb.graph.nodes), len(changedGraph.edges), len(gb.graph.edges)))
+	if err := populateGraphDb(gb.builderConfig, changedGraph, gb.writeTags()); err != nil {
+		return err
+	}
+	return saveGraphRunState(runStatePath, nextRunState)
+}
 
+// Returns the tags of the graph elements written by this run. The scope is the Artifactory URL.
+func (gb *GraphBuilder) writeTags() *graphWriteTags {
+	return &graphWriteTags{scope: strings.TrimSuffix(gb.baseUrl, "/"), runId: gb.runId}
+}
+
+// Populates the in-memory graph with the repositories, builds, images and release bundles.
+func (gb *GraphBuilder) collectGraph() error {
 	// Create repositories relations.
 	err := gb.createRepositoriesGraphRelations()
 	if err != nil {
@@ -130,19 +347,15 @@ func (gb *GraphBuilder) makeGraph() error {
 	if err != nil {
 		return err
 	}
-	// Populate graph.
-	err = gb.populateGraphDb()
-	if err != nil {
-		log.Error("Failed connecting to graphDB: " + err.Error())
+	if gb.builderConfig.dockerImages {
+		gb.createDockerImagesGraphRelations()
 	}
-	// Output results.
-	err = gb.outputResults()
-	if err != nil {
-		return err
+	if gb.builderConfig.releaseBundles {
+		gb.createReleaseBundlesGraphRelations()
+	}
+	if gb.summaryProvider != nil {
+		return gb.addXraySummaries()
 	}
-	endTime := time.Now()
-	log.Info(fmt.Sprintf("Graph creation took: %f seconds", endTime.Sub(startTime).Seconds()))
-
 	return nil
 }
 
@@ -153,13 +366,15 @@ func (gb *GraphBuilder) outputResults() error {
 			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 			fileName = "stechhelm-output-" + timestamp
 		}
-		err := ioutil.WriteFile(fileName, []byte(strings.Join(gb.graphBuilderCommands, "\n")), 0644)
-		if err != nil {
-			return errors.New("Failed creating file for output: " + err.Error())
+		for _, format := range gb.builderConfig.outputFormats {
+			err := writeGraphFile(graphOutputFileName(fileName, format), gb.graph, format)
+			if err != nil {
+				return errors.New("Failed creating file for output: " + err.Error())
+			}
 		}
 	}
 	if gb.builderConfig.verbose {
-		log.Info(fmt.Sprintf("Graph commands:\n%v", strings.Join(gb.graphBuilderCommands, "\n")))
+		log.Info(fmt.Sprintf("Graph commands:\n%v", getCypherScript(gb.graph)))
 	}
 	return nil
 }
@@ -180,122 +395,160 @@ func (gb *GraphBuilder) createBuildsGraphRelations() error {
 }
 
 func (gb *GraphBuilder) handleBuilds(builds []Build) error {
-	visitedChecksums := map[string]bool{}
+	checksums := newChecksumSet()
+	promoted, err := gb.getPromotedBuilds()
+	if err != nil {
+		return err
+	}
+	selection := gb.builderConfig.buildSelection
+	builds = selection.selectBuilds(builds, promoted)
+	log.Info(fmt.Sprintf("Handling %d build names", len(builds)))
+	// Builds which could not be fully collected are not recorded as processed, so that the next incremental run collects them again.
+	failedBuilds := map[string]bool{}
 	for _, build := range builds {
-		buildName := strings.TrimPrefix(build.Uri, "/")
-		buildInfoParms := services.BuildInfoParams{
-			BuildName:   buildName,
-			BuildNumber: "LATEST",
-		}
-		buildInfoObj, buildFound, err := gb.serviceManager.GetBuildInfo(buildInfoParms)
-		if err != nil {
-			log.Error(fmt.Sprintf("an error has occurred when fetching latest build for %s: %s", buildName, err.Error()))
+		if gb.runState.isBuildProcessed(&build) {
 			continue
 		}
-		if buildInfoObj == nil || !buildFound {
-			log.Info(fmt.Sprintf("Latest Build could not be found, name: %s", buildName))
+		buildName := build.name()
+		runs, latest, err := gb.getBuildNameRuns(buildName)
+		if err != nil {
+			log.Error(fmt.Sprintf("an error has occurred when fetching builds of %s: %s", buildName, err.Error()))
 			continue
 		}
-		buildInfo := buildInfoObj.BuildInfo
-		if len(buildInfo.Modules) == 0 {
-			log.Info(fmt.Sprintf("No modules found for build name: %s, number: %s", buildInfo.Name, buildInfo.Number))
-			continue
+		// Consecutive builds are linked, from the oldest to the newest.
+		// In incremental mode, the first new build is linked to the last processed one.
+		var previousBuildNode *graphNode
+		if lastBuild, ok := gb.runState.lastBuild(buildName); ok {
+			previousBuildNode = gb.graphCreateBuildNode(buildName, lastBuild.Number)
 		}
-
-		log.Info(fmt.Sprintf("Handling modules of build name: %s, number: %s", buildInfo.Name, buildInfo.Number))
-		// Handle modules.
-		for _, module := range buildInfo.Modules {
-			// Handle dependencies.
-			log.Info("Handling module id: " + module.Id)
-			for _, dependency := range module.Dependencies {
-				if dependency.Checksum == nil || dependency.Checksum.Sha1 == "" {
-					continue
-				}
-				err := gb.handleDependency(&dependency, &buildInfo, visitedChecksums)
-				if err != nil {
-					log.Info(fmt.Sprintf("an error has ocurred when handling build: %s dependency: %s", buildName, dependency.Sha1), err)
-				}
+		for _, run := range gb.runState.newRuns(buildName, selection.selectRuns(buildName, runs, promoted)) {
+			buildInfo, buildFound := latest, latest != nil
+			if latest == nil {
+				buildInfo, buildFound, err = gb.getBuildInfo(buildName, run.number())
 			}
-			// Handle artifacts.
-			for _, artifact := range module.Artifacts {
-				if artifact.Checksum == nil || artifact.Checksum.Sha1 == "" {
-					continue
-				}
-				err = gb.handleArtifact(&artifact, &buildInfo, visitedChecksums)
-				if err != nil {
-					log.Info(fmt.Sprintf("an error has ocurred when handling build: %s artifact: %s", buildName, artifact.Sha1), err)
-				}
+			if err != nil {
+				log.Error(fmt.Sprintf("an error has occurred when fetching build %s, number: %s: %s", buildName, run.number(), err.Error()))
+				failedBuilds[buildName] = true
+				continue
+			}
+			if buildInfo == nil || !buildFound {
+				log.Info(fmt.Sprintf("Build could not be found, name: %s, number: %s", buildName, run.number()))
+				continue
+			}
+			buildNode := gb.graphCreateBuildRunNode(buildInfo.Name, buildInfo.Number, buildInfo.Started, buildInfo.status())
+			if previousBuildNode != nil {
+				gb.graph.addEdge(relNextBuild, previousBuildNode, buildNode, nil)
 			}
+			previousBuildNode = buildNode
+			gb.processedBuilds[buildName] = processedBuild{Number: run.number(), Started: run.Started}
+			gb.handleBuildModules(&buildInfo.BuildInfo, checksums)
 		}
 	}
-	return nil
-}
-
-func (gb *GraphBuilder) handleArtifact(artifact *buildinfo.Artifact, buildInfo *buildinfo.BuildInfo,
-	visitedChecksums map[string]bool) error {
-	gb.graphCreateRelationshipBuildToArtifact(buildInfo.Name, buildInfo.Number, artifact.Sha1)
-	if _, ok := visitedChecksums[artifact.Sha1]; ok {
-		return nil
-	}
-	repoResults, err := gb.getRepositoryListBySha1(artifact.Sha1)
+	// The repositories storing the binaries are looked up once all the builds are handled, in batches.
+	failedChecksums, err := gb.linkChecksumsToRepos(checksums.values)
 	if err != nil {
-		log.Info(fmt.Sprintf("Could not find repositories for sha1 %s: %s", artifact.Sha1, err.Error()))
-		return nil
+		return err
+	}
+	for buildName := range gb.getChecksumsBuilds(failedChecksums) {
+		failedBuilds[buildName] = true
 	}
-	visitedChecksums[artifact.Sha1] = true
-	for _, repoResult := range repoResults {
-		repoName := repoResult.Repo
-		gb.linkBinToRepos(artifact.Sha1, repoName)
+	for buildName := range failedBuilds {
+		delete(gb.processedBuilds, buildName)
 	}
 	return nil
 }
 
-func (gb *GraphBuilder) handleDependency(dependency *buildinfo.Dependency, buildInfo *buildinfo.BuildInfo,
-	visitedChecksums map[string]bool) error {
-	gb.graphCreateRelationshipDependencyToBuild(buildInfo.Name, buildInfo.Number, dependency.Sha1)
-	if _, ok := visitedChecksums[dependency.Sha1]; ok {
-		return nil
-	}
-	repoResults, err := gb.getRepositoryListBySha1(dependency.Sha1)
-	if err != nil {
-		log.Info(fmt.Sprintf("Could not find repositories for sha1 %s: %s", dependency.Sha1, err.Error()))
-		return nil
+// Returns the runs of the build name. When only the latest build is selected, it is fetched directly, and returned too.
+func (gb *GraphBuilder) getBuildNameRuns(buildName string) ([]BuildRun, *buildInfoWithStatuses, error) {
+	if !gb.builderConfig.buildSelection.latestOnly() {
+		runs, err := gb.getBuildRuns(buildName)
+		return runs, nil, err
 	}
-	visitedChecksums[dependency.Sha1] = true
-	for _, repoResult := range repoResults {
-		repoName := repoResult.Repo
-		gb.linkBinToRepos(dependency.Sha1, repoName)
+	latest, found, err := gb.getLatestBuildInfo(buildName)
+	if err != nil || !found {
+		if err == nil {
+			log.Info("Latest build could not be found, name: " + buildName)
+		}
+		return nil, nil, err
 	}
-	return nil
+	return []BuildRun{{Uri: "/" + latest.Number, Started: latest.Started}}, latest, nil
 }
 
-func (gb *GraphBuilder) getRepositoryListBySha1(sha1 string) ([]Result, error) {
-	var stream io.ReadCloser
-	stream, err := gb.serviceManager.Aql(createAqlQueryForChecksumRepositories(sha1))
-	if err != nil {
-		return nil, err
+func (gb *GraphBuilder) handleBuildModules(buildInfo *buildinfo.BuildInfo, checksums *checksumSet) {
+	if len(buildInfo.Modules) == 0 {
+		log.Info(fmt.Sprintf("No modules found for build name: %s, number: %s", buildInfo.Name, buildInfo.Number))
+		return
 	}
-	defer stream.Close()
-	var result []byte
-	result, err = ioutil.ReadAll(stream)
-	if err != nil {
-		return nil, err
+
+	log.Info(fmt.Sprintf("Handling modules of build name: %s, number: %s", buildInfo.Name, buildInfo.Number))
+	// Handle modules.
+	for _, module := range buildInfo.Modules {
+		// Handle dependencies.
+		log.Info("Handling module id: " + module.Id)
+		for _, dependency := range module.Dependencies {
+			if dependency.Checksum == nil || dependency.Checksum.Sha1 == "" {
+				continue
+			}
+			gb.handleDependency(&dependency, &module, buildInfo, checksums)
+		}
+		// Handle artifacts.
+		for _, artifact := range module.Artifacts {
+			if artifact.Checksum == nil || artifact.Checksum.Sha1 == "" {
+				continue
+			}
+			gb.handleArtifact(&artifact, buildInfo, checksums)
+		}
 	}
-	if len(result) == 0 {
-		return nil, nil
+}
+
+func (gb *GraphBuilder) handleArtifact(artifact *buildinfo.Artifact, buildInfo *buildinfo.BuildInfo, checksums *checksumSet) {
+	gb.graphCreateRelationshipBuildToArtifact(buildInfo.Name, buildInfo.Number, artifact.Sha1)
+	checksums.add(artifact.Sha1)
+}
+
+func (gb *GraphBuilder) handleDependency(dependency *buildinfo.Dependency, module *buildinfo.Module, buildInfo *buildinfo.BuildInfo, checksums *checksumSet) {
+	gb.graphCreateRelationshipDependencyToBuild(buildInfo.Name, buildInfo.Number, dependency.Sha1)
+	checksums.add(dependency.Sha1)
+	if dependency.Id != "" {
+		componentNode := gb.graphCreateComponentNode(componentId(string(module.Type), dependency.Id), string(module.Type), dependency.Type, dependency.Scopes)
+		gb.graph.addEdge(relProvides, gb.graphCreateBinaryNode(dependency.Sha1), componentNode, nil)
+		gb.handleRequestedBy(componentNode, dependency, module, buildInfo)
 	}
-	parsedResults := Sha1AqlResults{}
-	if err = json.Unmarshal(result, &parsedResults); err != nil {
-		return nil, err
+}
+
+// Links the component to the components which requested it, up to the direct dependencies declared by the module,
+// which are linked to the build. Each requested-by path starts with the component parent, and may end with the module.
+func (gb *GraphBuilder) handleRequestedBy(componentNode *graphNode, dependency *buildinfo.Dependency, module *buildinfo.Module, buildInfo *buildinfo.BuildInfo) {
+	buildNode := gb.graphCreateBuildNode(buildInfo.Name, buildInfo.Number)
+	if len(dependency.RequestedBy) == 0 {
+		gb.graph.addEdge(relDependencyFor, componentNode, buildNode, nil)
+		return
 	}
-	if len(parsedResults.Results) == 0 {
-		return nil, nil
+	packageType := string(module.Type)
+	for _, path := range dependency.RequestedBy {
+		requested := componentNode
+		for _, requesterId := range path {
+			if requesterId == module.Id {
+				break
+			}
+			requester := gb.graphCreateComponentNode(componentId(packageType, requesterId), packageType, "", nil)
+			gb.graph.addEdge(relRequestedBy, requested, requester, nil)
+			requested = requester
+		}
+		gb.graph.addEdge(relDependencyFor, requested, buildNode, nil)
+	}
+}
+
+// Returns the component id, prefixed with the package type if known, e.g. npm:lodash:4.17.21.
+func componentId(packageType, dependencyId string) string {
+	if packageType == "" {
+		return dependencyId
 	}
-	return parsedResults.Results, nil
+	return strings.ToLower(packageType) + ":" + dependencyId
 }
 
 func (gb *GraphBuilder) getAllBuilds() ([]Build, error) {
-	resp, respBody, _, err := gb.serviceManager.Client().SendGet(fmt.Sprintf("%s%s", gb.baseUrl, "api/build"), true, &gb.clientDetails)
+	resp, respBody, _, err := gb.serviceManager.Client().SendGet(fmt.Sprintf("%s%s%s", gb.baseUrl, "api/build", gb.builderConfig.buildSelection.projectQuery()), true, &gb.clientDetails)
 	if err != nil {
 		return nil, err
 	}
@@ -335,19 +588,34 @@ func (gb *GraphBuilder) handleVirtualRepositories() error {
 	if err != nil {
 		return err
 	}
+	// All virtual nodes are created before linking, since a virtual repository may include another virtual repository.
+	var virtualRepos []*VirtualRepositoryDetails
 	for _, repositoryDetail := range *virtualReposDetails {
-		repositoryConfig := VirtualRepositoryDetails{}
-		err := gb.serviceManager.GetRepository(repositoryDetail.Key, &repositoryConfig)
+		if !gb.repoFilter.matches(repositoryDetail.Key, "virtual", repositoryDetail.PackageType) {
+			continue
+		}
+		repositoryConfig := &VirtualRepositoryDetails{}
+		err := gb.collectRepositoryConfig(repositoryDetail.Key, repositoryConfig)
 		if err != nil {
 			return err
 		}
-		isSafe := checkVirtualRepoSafety(&repositoryConfig, gb.allRepos)
+		risks := getVirtualRepoRisks(repositoryConfig, gb.allRepos)
+		isSafe := len(risks) == 0
+		for _, risk := range risks {
+			gb.findings = append(gb.findings, finding{Repo: repositoryConfig.Key, Rclass: "virtual",
+				PackageType: strings.ToLower(repositoryConfig.PackageType), Rule: ruleVirtualMembers, Reason: risk})
+		}
 		gb.graphCreateVirtualRepoNode(repositoryConfig.Key, "VIRTUAL", repositoryConfig.PriorityResolution,
 			repositoryConfig.IncludesPattern != "**/*", repositoryConfig.ExcludesPattern != "", repositoryConfig.XrayIndex, isSafe)
+		virtualRepos = append(virtualRepos, repositoryConfig)
+	}
 
+	for _, repositoryConfig := range virtualRepos {
 		// Populate repositories to virtuals map.
 		for _, linkedRepo := range repositoryConfig.Repositories {
-			gb.graphCreateRelationshipVirtualToLocalOrRemote(repositoryConfig.Key, linkedRepo)
+			if linkedRepoConfig, ok := gb.allRepos[linkedRepo]; !ok || gb.repoFilter.matchesRepo(linkedRepoConfig) {
+				gb.graphCreateRelationshipVirtualToLocalOrRemote(repositoryConfig.Key, linkedRepo)
+			}
 			if linkedRepoVirtuals, ok := gb.repoToVirtualMapping[linkedRepo]; ok {
 				// linkedRepo has a list of virtuals.
 				if _, ok2 := linkedRepoVirtuals[repositoryConfig.Key]; !ok2 {
@@ -372,13 +640,17 @@ func (gb *GraphBuilder) handleLocalRepositories() error {
 	}
 	for _, repositoryDetail := range *localReposDetails {
 		repositoryConfig := CommonRepositoryDetails{}
-		err := gb.serviceManager.GetRepository(repositoryDetail.Key, &repositoryConfig)
+		err := gb.collectRepositoryConfig(repositoryDetail.Key, &repositoryConfig)
 		if err != nil {
 			return err
 		}
+		// Filtered out repositories are kept in allRepos, since virtual repositories safety depends on them.
+		gb.allRepos[repositoryConfig.Key] = &repositoryConfig
+		if !gb.repoFilter.matchesRepo(&repositoryConfig) {
+			continue
+		}
 		gb.graphCreateRepoNode(repositoryConfig.Key, "LOCAL", repositoryConfig.PriorityResolution,
 			repositoryConfig.IncludesPattern != "**/*", repositoryConfig.ExcludesPattern != "", repositoryConfig.XrayIndex)
-		gb.allRepos[repositoryConfig.Key] = &repositoryConfig
 	}
 	return nil
 }
@@ -392,18 +664,51 @@ func (gb *GraphBuilder) handleRemoteRepositories() error {
 	}
 	for _, repositoryDetail := range *remoteReposDetails {
 		repositoryConfig := CommonRepositoryDetails{}
-		err := gb.serviceManager.GetRepository(repositoryDetail.Key, &repositoryConfig)
+		err := gb.collectRepositoryConfig(repositoryDetail.Key, &repositoryConfig)
 		if err != nil {
 			return err
 		}
-		gb.graphCreateRepoNode(repositoryConfig.Key, "REMOTE", repositoryConfig.PriorityResolution,
-			repositoryConfig.IncludesPattern != "**/*", repositoryConfig.ExcludesPattern != "", repositoryConfig.XrayIndex)
+		// Filtered out repositories are kept in allRepos, since virtual repositories safety depends on them.
 		gb.allRepos[repositoryConfig.Key] = &repositoryConfig
+		if !gb.repoFilter.matchesRepo(&repositoryConfig) {
+			continue
+		}
+		gb.graphCreateRemoteRepoNode(repositoryConfig.Key, repositoryConfig.Url, repositoryConfig.PriorityResolution,
+			repositoryConfig.IncludesPattern != "**/*", repositoryConfig.ExcludesPattern != "", repositoryConfig.XrayIndex)
 	}
 	return nil
 }
 
+// Reads the repository configuration from the cache, or fetches and caches it.
+func (gb *GraphBuilder) getRepositoryConfig(repoKey string, repositoryConfig interface{}) error {
+	if gb.cache == nil {
+		return gb.serviceManager.GetRepository(repoKey, repositoryConfig)
+	}
+	if gb.cache.get(cacheRepositories, repoKey, gb.builderConfig.cache.repoTTL, repositoryConfig) && !isMissingUrl(repositoryConfig) {
+		return nil
+	}
+	if err := gb.serviceManager.GetRepository(repoKey, repositoryConfig); err != nil {
+		return err
+	}
+	gb.cache.put(cacheRepositories, repoKey, repositoryConfig)
+	return nil
+}
+
+// Returns true for a remote repository configuration without its URL, as cached by versions which didn't read the URL.
+func isMissingUrl(repositoryConfig interface{}) bool {
+	repoConfig, ok := repositoryConfig.(*CommonRepositoryDetails)
+	return ok && strings.EqualFold(repoConfig.Rclass, "remote") && repoConfig.Url == ""
+}
+
 func (gb *GraphBuilder) linkBinToRepos(sha1, localOrRemoteRepo string) {
+	gb.linkToRepos(localOrRemoteRepo, func(repoName string) {
+		gb.graphCreateRelationshipBinaryToRepo(sha1, repoName)
+	})
+}
+
+// Calls link with the repositories exposing the content of the local or remote repository:
+// the repository itself, or the virtual repositories including it.
+func (gb *GraphBuilder) linkToRepos(localOrRemoteRepo string, link func(repoName string)) {
 	localOrRemoteRepo = strings.TrimSuffix(localOrRemoteRepo, "-cache")
 	repoConfig, ok := gb.allRepos[localOrRemoteRepo]
 	if !ok {
@@ -412,105 +717,126 @@ func (gb *GraphBuilder) linkBinToRepos(sha1, localOrRemoteRepo string) {
 	}
 	if strings.EqualFold(repoConfig.Rclass, "local") {
 		// Link to local.
-		gb.graphCreateRelationshipBinaryToRepo(sha1, localOrRemoteRepo)
+		if gb.repoFilter.matchesRepo(repoConfig) {
+			link(localOrRemoteRepo)
+		}
 		return
 	}
-	// Link to virtual.
+	// Link to virtual. The mapping only contains virtual repositories which passed the filter.
 	virtualRepos, exists := gb.repoToVirtualMapping[localOrRemoteRepo]
 	if !exists {
-		gb.graphCreateRelationshipBinaryToRepo(sha1, localOrRemoteRepo)
+		if gb.repoFilter.matchesRepo(repoConfig) {
+			link(localOrRemoteRepo)
+		}
 	} else {
 		for virtualRepo := range virtualRepos {
-			gb.graphCreateRelationshipBinaryToRepo(sha1, virtualRepo)
+			link(virtualRepo)
 		}
 	}
 }
 
-func (gb *GraphBuilder) populateGraphDb() error {
-	if gb.builderConfig.graphUrl == "" {
-		return nil
-	}
-	driver, err := neo4j.NewDriver(gb.builderConfig.graphUrl, neo4j.BasicAuth(gb.builderConfig.graphUser, gb.builderConfig.graphPassword, gb.builderConfig.graphRealm))
-	if err != nil {
-		return err
-	}
-	defer func() { err = closeDbConnection(driver, err) }()
-	session := driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead, DatabaseName: gb.builderConfig.graphDatabase})
-	defer func() { err = closeDbConnection(session, err) }()
-	log.Info("Populating graph data to neo4j, this may take a while...")
-	for _, command := range gb.graphBuilderCommands {
-		_, err = session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
-			_, err := transaction.Run(command, nil)
-			if err != nil {
-				log.Error(fmt.Sprintf("Failed publishing command: %s to graphDB: %s", command, err.Error()))
-			}
-			return nil, err
-		})
+func (gb *GraphBuilder) graphCreateAttackerNode() *graphNode {
+	return gb.graph.addNode(labelAttacker, map[string]interface{}{"name": "attacker"}, "name")
+}
+
+func (gb *GraphBuilder) graphCreateBuildNode(buildName, buildNumber string) *graphNode {
+	return gb.graph.addNode(labelBuild, map[string]interface{}{"name": buildName, "number": buildNumber}, "name", "number")
+}
+
+// Creates the build node with the time the build started and its latest promotion status, if any.
+func (gb *GraphBuilder) graphCreateBuildRunNode(buildName, buildNumber, started, status string) *graphNode {
+	properties := map[string]interface{}{"name": buildName, "number": buildNumber, "started": started}
+	if status != "" {
+		properties["status"] = status
 	}
-	return err
+	return gb.graph.addNode(labelBuild, properties, "name", "number")
 }
 
-func closeDbConnection(closer io.Closer, previousError error) error {
-	err := closer.Close()
-	if err == nil {
-		return previousError
+// Creates the component node. The scopes of the component in all the builds are kept.
+func (gb *GraphBuilder) graphCreateComponentNode(id, packageType, fileType string, scopes []string) *graphNode {
+	properties := map[string]interface{}{"id": id}
+	if packageType != "" {
+		properties["package_type"] = strings.ToLower(packageType)
 	}
-	if previousError == nil {
-		return err
+	if fileType != "" {
+		properties["type"] = fileType
+	}
+	if existing := gb.graph.getNode(labelComponent, id); existing != nil {
+		if existingScopes, ok := existing.properties["scopes"].([]string); ok {
+			scopes = append(append([]string{}, existingScopes...), scopes...)
+		}
 	}
-	return fmt.Errorf("%v closure error occurred:\n%s\ninitial error was:\n%w", reflect.TypeOf(closer), err.Error(), previousError)
+	var uniqueScopes []string
+	for _, scope := range scopes {
+		uniqueScopes = appendUnique(uniqueScopes, scope)
+	}
+	if len(uniqueScopes) > 0 {
+		sort.Strings(uniqueScopes)
+		properties["scopes"] = uniqueScopes
+	}
+	return gb.graph.addNode(labelComponent, properties, "id")
+}
+
+func (gb *GraphBuilder) graphCreateBinaryNode(binarySha string) *graphNode {
+	return gb.graph.addNode(labelBinary, map[string]interface{}{"sha1": binarySha}, "sha1")
 }
 
-func (gb *GraphBuilder) graphAddCommand(cmd string) {
-	if _, ok := gb.cypherCommands[cmd]; !ok {
-		gb.cypherCommands[cmd] = true
-		gb.graphBuilderCommands = append(gb.graphBuilderCommands, cmd)
+// Returns the node of the repository with the given name, or nil if the repository is not in the graph.
+func (gb *GraphBuilder) getRepoNode(repoName string) *graphNode {
+	for _, label := range repoLabels {
+		if node := gb.graph.getNode(label, repoName); node != nil {
+			return node
+		}
 	}
+	return nil
 }
 
 func (gb *GraphBuilder) graphCreateRelationshipBinaryToRepo(binarySha, repoName string) {
-	gb.graphAddCommand(fmt.Sprintf(`MATCH (bin:Binary {sha1: "%s"}), (repo {name: "%s"}) MERGE (repo)-[r:STORES]->(bin);`,
-		binarySha, repoName))
+	repoNode := gb.getRepoNode(repoName)
+	if repoNode == nil {
+		return
+	}
+	gb.graph.addEdge(relStores, repoNode, gb.graphCreateBinaryNode(binarySha), nil)
 }
 
 func (gb *GraphBuilder) graphCreateRelationshipDependencyToBuild(buildName, buildNumber, binarySha string) {
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (build:Build {name: "%s", number: "%s"});`, buildName, buildNumber))
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (bin:Binary {sha1: "%s"});`, binarySha))
-	gb.graphAddCommand(fmt.Sprintf(`MATCH (build:Build {name: "%s", number: "%s"}), (bin:Binary {sha1: "%s"}) MERGE (bin)-[r:DEPENDENCY_FOR]->(build);`,
-		buildName, buildNumber, binarySha))
+	gb.graph.addEdge(relDependencyFor, gb.graphCreateBinaryNode(binarySha), gb.graphCreateBuildNode(buildName, buildNumber), nil)
 }
 
 func (gb *GraphBuilder) graphCreateRelationshipBuildToArtifact(buildName, buildNumber, binarySha string) {
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (build:Build {name: "%s", number: "%s"});`, buildName, buildNumber))
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (bin:Binary {sha1: "%s"});`, binarySha))
-	gb.graphAddCommand(fmt.Sprintf(`MATCH (bin:Binary {sha1: "%s"}), (build:Build {name: "%s", number: "%s"}) MERGE (build)-[r:PRODUCE]->(bin);`,
-		binarySha, buildName, buildNumber))
+	gb.graph.addEdge(relProduce, gb.graphCreateBuildNode(buildName, buildNumber), gb.graphCreateBinaryNode(binarySha), nil)
 }
 
 func (gb *GraphBuilder) graphCreateRelationshipVirtualToLocalOrRemote(name, repo string) {
-	gb.graphAddCommand(fmt.Sprintf(`MATCH (repoV:RepoVIRTUAL {name: "%s"}), (repo {name: "%s"}) MERGE (repo)-[r:LINKED_TO]->(repoV);`,
-		name, repo))
+	virtualNode := gb.graph.getNode(labelRepoVirtual, name)
+	repoNode := gb.getRepoNode(repo)
+	if virtualNode == nil || repoNode == nil {
+		return
+	}
+	gb.graph.addEdge(relLinkedTo, repoNode, virtualNode, nil)
 }
 
 func (gb *GraphBuilder) graphCreateVirtualRepoNode(name, repoType string, isPriority, isInc, isExc, isXray, isSafe bool) {
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (repo:Repo%s {name: "%s", type: "%s", is_priority: "%s", is_inc: "%s", is_exc: "%s", is_xray: "%s", is_safe: "%s"});`,
-		repoType, name, repoType, strconv.FormatBool(isPriority), strconv.FormatBool(isInc), strconv.FormatBool(isExc), strconv.FormatBool(isXray), strconv.FormatBool(isSafe)))
+	gb.graph.addNode("Repo"+repoType, map[string]interface{}{"name": name, "type": repoType, "is_priority": isPriority,
+		"is_inc": isInc, "is_exc": isExc, "is_xray": isXray, "is_safe": isSafe}, "name")
 }
 
+// Creates the repository node. A remote repository without a known upstream is attacked directly.
 func (gb *GraphBuilder) graphCreateRepoNode(name, repoType string, isPriority, isInc, isExc, isXray bool) {
-	gb.graphAddCommand(fmt.Sprintf(`MERGE (repo:Repo%s {name: "%s", type: "%s", is_priority: "%s", is_inc: "%s", is_exc: "%s", is_xray: "%s"});`,
-		repoType, name, repoType, strconv.FormatBool(isPriority), strconv.FormatBool(isInc), strconv.FormatBool(isExc), strconv.FormatBool(isXray)))
+	repoNode := gb.addRepoNode(name, repoType, isPriority, isInc, isExc, isXray)
 	if strings.EqualFold("remote", repoType) {
-		gb.graphAddCommand(fmt.Sprintf(`MATCH (x:Attacker {name:"attacker"}), (repo:RepoREMOTE {name: "%s"}) MERGE (x)-[r:ATTACKS]->(repo);`, name))
+		gb.linkRemoteToUpstream(repoNode, "")
 	}
 }
 
-func createAqlQueryForChecksumRepositories(sha1 string) string {
-	itemsPart :=
-		`items.find({` +
-			`"actual_sha1": "%s"` +
-			`}).include("repo")`
-	return fmt.Sprintf(itemsPart, sha1)
+// Creates the remote repository node, linked to the upstream of its URL.
+func (gb *GraphBuilder) graphCreateRemoteRepoNode(name, remoteUrl string, isPriority, isInc, isExc, isXray bool) {
+	gb.linkRemoteToUpstream(gb.addRepoNode(name, "REMOTE", isPriority, isInc, isExc, isXray), remoteUrl)
+}
+
+func (gb *GraphBuilder) addRepoNode(name, repoType string, isPriority, isInc, isExc, isXray bool) *graphNode {
+	return gb.graph.addNode("Repo"+repoType, map[string]interface{}{"name": name, "type": repoType, "is_priority": isPriority,
+		"is_inc": isInc, "is_exc": isExc, "is_xray": isXray}, "name")
 }
 
 type Sha1AqlResults struct {
@@ -518,7 +844,11 @@ type Sha1AqlResults struct {
 }
 
 type Result struct {
-	Repo string `json:"repo"`
+	Repo       string `json:"repo"`
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	ActualSha1 string `json:"actual_sha1"`
+	Sha256     string `json:"sha256"`
 }
 
 type Builds struct {
@@ -526,7 +856,28 @@ type Builds struct {
 }
 
 type Build struct {
-	Uri string `json:"uri"`
+	Uri         string `json:"uri"`
+	LastStarted string `json:"lastStarted"`
+}
+
+func writeGraphFile(path string, graph *graphModel, format string) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = closeWithError(file, err) }()
+	log.Info(fmt.Sprintf("Writing the graph as %s to %s", format, path))
+	return exportGraph(file, graph, format)
+}
+
+func getGraphOutputFormats(c *components.Context) ([]string, error) {
+	formats := splitFlagList(c.GetStringFlagValue("output-format"))
+	for _, format := range formats {
+		if !containsString(graphOutputFormats, format) {
+			return nil, fmt.Errorf("unsupported output format '%s', expected one of: %s", format, strings.Join(graphOutputFormats, ", "))
+		}
+	}
+	return formats, nil
 }
 
 func getGraphArguments() []components.Argument {
@@ -534,7 +885,7 @@ func getGraphArguments() []components.Argument {
 }
 
 func getGraphFlags() []components.Flag {
-	return []components.Flag{
+	graphFlags := []components.Flag{
 		components.StringFlag{
 			Name:        "server-id",
 			Description: "Artifactory server ID configured using the config command.",
@@ -564,6 +915,11 @@ func getGraphFlags() []components.Flag {
 			Name:        "graph-realm",
 			Description: "neo4j realm.",
 		},
+		components.StringFlag{
+			Name:         "graph-batch-size",
+			Description:  "[Default: 1000] Number of nodes or relationships written to neo4j in a single transaction.",
+			DefaultValue: "1000",
+		},
 		components.BoolFlag{
 			Name:         "output-to-file",
 			Description:  "[Default: false] Set to true to output the graph-building queries to a file.",
@@ -573,5 +929,21 @@ func getGraphFlags() []components.Flag {
 			Name:        "output-file-path",
 			Description: "[Default: current workdir] Path to an output file for the graph-building queries.",
 		},
-	}
+		components.StringFlag{
+			Name: "output-format",
+			Description: "[Default: cypher] Comma-separated list of formats to write the graph to files in. Implies output-to-file. " +
+				"Supported values: cypher, graphml, gexf, dot, json, html. Files other than the cypher script get the format extension added to the output file path.",
+		},
+		getMetricsFileFlag(),
+		getStateFileFlag(),
+	}
+	return joinFlagGroups([][]components.Flag{
+		graphFlags,
+		getCollectorFlags(),
+		getIncrementalFlags(),
+		getPruneFlags(),
+		getXrayFlags(),
+		getNotifierFlags(),
+		getRepoFilterFlags(),
+	})
 }
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"github.com/jfrog/jfrog-client-go/artifactory/buildinfo"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -8,50 +9,157 @@ import (
 func TestLinkBinToAllVirtualRepos(t *testing.T) {
 	gb := &GraphBuilder{
 		baseUrl:              "http://dummy.url",
-		graphBuilderCommands: []string{},
-		cypherCommands:       make(map[string]bool),
+		graph:                newGraphModel(),
 		repoToVirtualMapping: make(map[string]map[string]bool),
-		allRepos:             make(map[string]*CommonRepositoryDetails),
+		allRepos: map[string]*CommonRepositoryDetails{
+			"repo1": {Key: "repo1", Rclass: "local"},
+			"repo2": {Key: "repo2", Rclass: "local"},
+		},
 	}
+	gb.graphCreateRepoNode("repo1", "LOCAL", true, false, false, true)
+	gb.graphCreateRepoNode("repo2", "LOCAL", true, false, false, true)
 
 	// Link artifact to repo.
 	gb.linkBinToRepos("sha1", "repo1")
-	assert.Equal(t, 1, len(gb.graphBuilderCommands))
-	assert.Equal(t, 1, len(gb.cypherCommands))
+	assert.Equal(t, 1, len(gb.graph.edges))
 
 	// Link same artifact to same repo - should have no change.
 	gb.linkBinToRepos("sha1", "repo1")
-	assert.Equal(t, 1, len(gb.graphBuilderCommands))
-	assert.Equal(t, 1, len(gb.cypherCommands))
+	assert.Equal(t, 1, len(gb.graph.edges))
 
 	// Link another artifact to same repo.
 	gb.linkBinToRepos("sha2", "repo1")
-	assert.Equal(t, 2, len(gb.graphBuilderCommands))
-	assert.Equal(t, 2, len(gb.cypherCommands))
+	assert.Equal(t, 2, len(gb.graph.edges))
 
 	// Link second artifact to another repo.
 	gb.linkBinToRepos("sha2", "repo2")
-	assert.Equal(t, 3, len(gb.graphBuilderCommands))
-	assert.Equal(t, 3, len(gb.cypherCommands))
+	assert.Equal(t, 3, len(gb.graph.edges))
 
 	// Link second artifact to first repo.
 	gb.linkBinToRepos("sha2", "repo2")
-	assert.Equal(t, 3, len(gb.graphBuilderCommands))
-	assert.Equal(t, 3, len(gb.cypherCommands))
+	assert.Equal(t, 3, len(gb.graph.edges))
+}
+
+func TestLinkBinToReposWithFilter(t *testing.T) {
+	filter, err := newRepoFilter("", "excluded-*", "", "")
+	assert.NoError(t, err)
+	gb := &GraphBuilder{
+		baseUrl:              "http://dummy.url",
+		graph:                newGraphModel(),
+		repoToVirtualMapping: map[string]map[string]bool{"excluded-remote": {"virtual1": true}},
+		allRepos: map[string]*CommonRepositoryDetails{
+			"local1":          {Key: "local1", Rclass: "local"},
+			"excluded-local":  {Key: "excluded-local", Rclass: "local"},
+			"excluded-remote": {Key: "excluded-remote", Rclass: "remote"},
+		},
+		repoFilter: filter,
+	}
+	gb.graphCreateRepoNode("local1", "LOCAL", true, false, false, true)
+	gb.graphCreateVirtualRepoNode("virtual1", "VIRTUAL", true, false, false, true, true)
+
+	// Binaries in filtered out local repositories are not linked.
+	gb.linkBinToRepos("sha1", "excluded-local")
+	assert.Equal(t, 0, len(gb.graph.edges))
+
+	gb.linkBinToRepos("sha1", "local1")
+	assert.Equal(t, 1, len(gb.graph.edges))
+
+	// Binaries cached by a filtered out remote are still linked to its virtual repositories.
+	gb.linkBinToRepos("sha1", "excluded-remote-cache")
+	assert.Equal(t, 2, len(gb.graph.edges))
+	assert.Equal(t, "virtual1", gb.graph.edges[1].from.properties["name"])
+}
+
+func TestGraphModelCounts(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRelationshipDependencyToBuild("build1", "1", "sha1")
+	gb.graphCreateRelationshipBuildToArtifact("build1", "1", "sha2")
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, false, false, false)
+
+	// Nodes and edges are counted once, even if added again.
+	gb.graphCreateRelationshipDependencyToBuild("build1", "1", "sha1")
+	assert.Equal(t, map[string]int{"Build": 1, "Binary": 2, "RepoREMOTE": 1, "Attacker": 1}, gb.graph.nodeCounts())
+	assert.Equal(t, map[string]int{"DEPENDENCY_FOR": 1, "PRODUCE": 1, "ATTACKS": 1}, gb.graph.edgeCounts())
+}
+
+func TestGraphNodePropertiesAreTyped(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateVirtualRepoNode("virtual1", "VIRTUAL", true, false, false, true, false)
+	node := gb.graph.getNode(labelRepoVirtual, "virtual1")
+	assert.Equal(t, false, node.properties["is_safe"])
+	assert.Equal(t, true, node.properties["is_priority"])
+
+	// Edges to repositories which are not in the graph are skipped.
+	gb.graphCreateRelationshipVirtualToLocalOrRemote("virtual1", "missing")
+	assert.Empty(t, gb.graph.edges)
 }
 
 func TestCreateAqlQueryForChecksumRepositories(t *testing.T) {
 	var inputTestCase = []struct {
-		input    string
+		input    []string
 		expected string
 	}{
-		{"1234567890", "items.find({\"actual_sha1\": \"1234567890\"}).include(\"repo\")"},
-		{"91d50642dd930e9542c39d36f0516d45f4e1af0d", "items.find({\"actual_sha1\": \"91d50642dd930e9542c39d36f0516d45f4e1af0d\"}).include(\"repo\")"},
+		{[]string{"1234567890"}, "items.find({\"$or\": [{\"actual_sha1\": \"1234567890\"}]}).include(\"repo\", \"path\", \"name\", \"actual_sha1\", \"sha256\")"},
+		{[]string{"91d50642dd930e9542c39d36f0516d45f4e1af0d", "1234567890"}, "items.find({\"$or\": [{\"actual_sha1\": \"91d50642dd930e9542c39d36f0516d45f4e1af0d\"}, " +
+			"{\"actual_sha1\": \"1234567890\"}]}).include(\"repo\", \"path\", \"name\", \"actual_sha1\", \"sha256\")"},
 	}
 	for _, testCase := range inputTestCase {
 		res := createAqlQueryForChecksumRepositories(testCase.input)
 		if res != testCase.expected {
-			t.Errorf("The expected output of createAqlQueryForChecksumRepositories(\"%s\") is %s. But the actual result is:%s", testCase.input, testCase.expected, res)
+			t.Errorf("The expected output of createAqlQueryForChecksumRepositories(%q) is %s. But the actual result is:%s", testCase.input, testCase.expected, res)
 		}
 	}
 }
+
+func TestHandleDependencyComponents(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	checksums := newChecksumSet()
+	buildInfo := &buildinfo.BuildInfo{Name: "app", Number: "1", Modules: []buildinfo.Module{
+		{Id: "app", Type: "npm", Dependencies: []buildinfo.Dependency{
+			{Id: "lodash:4.17.21", Type: "tgz", Scopes: []string{"prod"}, Checksum: &buildinfo.Checksum{Sha1: "sha1"}},
+			{Id: "lodash:4.17.21", Scopes: []string{"dev", "prod"}, Checksum: &buildinfo.Checksum{Sha1: "sha1"}},
+			{Id: "no-checksum:1.0.0"},
+		}},
+		{Id: "lib", Dependencies: []buildinfo.Dependency{{Id: "org:lib:1.0", Checksum: &buildinfo.Checksum{Sha1: "sha2"}}}},
+	}}
+	gb.handleBuildModules(buildInfo, checksums)
+
+	component := gb.graph.getNode(labelComponent, "npm:lodash:4.17.21")
+	if assert.NotNil(t, component) {
+		assert.Equal(t, "npm", component.properties["package_type"])
+		assert.Equal(t, "tgz", component.properties["type"])
+		assert.Equal(t, []string{"dev", "prod"}, component.properties["scopes"])
+		assert.Contains(t, gb.graph.edgeById, edgeId(relProvides, gb.graph.getNode(labelBinary, "sha1"), component))
+	}
+	assert.NotNil(t, gb.graph.getNode(labelComponent, "org:lib:1.0"))
+	assert.Equal(t, map[string]int{labelBinary: 2, labelBuild: 1, labelComponent: 2}, gb.graph.nodeCounts())
+	assert.Equal(t, map[string]int{relDependencyFor: 4, relProvides: 2}, gb.graph.edgeCounts())
+	assert.Equal(t, []string{"sha1", "sha2"}, checksums.values)
+}
+
+func TestHandleRequestedBy(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	buildInfo := &buildinfo.BuildInfo{Name: "app", Number: "1", Modules: []buildinfo.Module{
+		{Id: "app:1.0", Type: "npm", Dependencies: []buildinfo.Dependency{
+			{Id: "express:4.17.1", Checksum: &buildinfo.Checksum{Sha1: "sha1"}},
+			{Id: "body-parser:1.19.0", Checksum: &buildinfo.Checksum{Sha1: "sha2"},
+				RequestedBy: [][]string{{"express:4.17.1", "app:1.0"}}},
+			{Id: "qs:6.7.0", Checksum: &buildinfo.Checksum{Sha1: "sha3"},
+				RequestedBy: [][]string{{"body-parser:1.19.0", "express:4.17.1", "app:1.0"}, {"express:4.17.1"}}},
+		}},
+	}}
+	gb.handleBuildModules(buildInfo, newChecksumSet())
+
+	build := gb.graph.getNode(labelBuild, "app", "1")
+	express := gb.graph.getNode(labelComponent, "npm:express:4.17.1")
+	bodyParser := gb.graph.getNode(labelComponent, "npm:body-parser:1.19.0")
+	qs := gb.graph.getNode(labelComponent, "npm:qs:6.7.0")
+	if assert.NotNil(t, express) && assert.NotNil(t, bodyParser) && assert.NotNil(t, qs) {
+		assert.Contains(t, gb.graph.edgeById, edgeId(relRequestedBy, bodyParser, express))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relRequestedBy, qs, bodyParser))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relRequestedBy, qs, express))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relDependencyFor, express, build))
+		assert.NotContains(t, gb.graph.edgeById, edgeId(relDependencyFor, qs, build))
+	}
+	assert.Equal(t, map[string]int{relDependencyFor: 4, relProvides: 3, relRequestedBy: 3}, gb.graph.edgeCounts())
+}
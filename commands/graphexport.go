@@ -0,0 +1,401 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatCypher  = "cypher"
+	formatGraphML = "graphml"
+	formatGexf    = "gexf"
+	formatDot     = "dot"
+	formatJson    = "json"
+	formatHtml    = "html"
+)
+
+var graphOutputFormats = []string{formatCypher, formatGraphML, formatGexf, formatDot, formatJson, formatHtml}
+
+// File extension per output format. The Cypher script is written without an extension.
+var graphFormatExtensions = map[string]string{
+	formatGraphML: ".graphml",
+	formatGexf:    ".gexf",
+	formatDot:     ".dot",
+	formatJson:    ".json",
+	formatHtml:    ".html",
+}
+
+func exportGraph(w io.Writer, graph *graphModel, format string) error {
+	switch format {
+	case formatGraphML:
+		return exportGraphML(w, graph)
+	case formatGexf:
+		return exportGexf(w, graph)
+	case formatDot:
+		return exportDot(w, graph)
+	case formatJson:
+		return exportJson(w, graph)
+	case formatHtml:
+		return exportHtml(w, graph)
+	default:
+		_, err := io.WriteString(w, getCypherScript(graph))
+		return err
+	}
+}
+
+// Returns the file name for the format, adding the format extension unless the base name already has it.
+func graphOutputFileName(baseName, format string) string {
+	extension := graphFormatExtensions[format]
+	if strings.HasSuffix(baseName, extension) {
+		return baseName
+	}
+	return baseName + extension
+}
+
+// Returns the ids used for the nodes in the exported files, by the order in which the nodes were added.
+func exportNodeIds(graph *graphModel) map[*graphNode]string {
+	ids := map[*graphNode]string{}
+	for i, node := range graph.nodes {
+		ids[node] = "n" + strconv.Itoa(i)
+	}
+	return ids
+}
+
+type propertyDefinition struct {
+	name     string
+	dataType string
+}
+
+// Returns the definitions of the properties of the nodes or edges, sorted by name.
+// The data type is one of string, boolean, long or double, as used by GraphML and GEXF.
+func propertyDefinitions(propertiesList []map[string]interface{}) []propertyDefinition {
+	types := map[string]string{}
+	for _, properties := range propertiesList {
+		for name, value := range properties {
+			if _, ok := types[name]; !ok {
+				types[name] = propertyDataType(value)
+			}
+		}
+	}
+	var definitions []propertyDefinition
+	for name, dataType := range types {
+		definitions = append(definitions, propertyDefinition{name: name, dataType: dataType})
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].name < definitions[j].name
+	})
+	return definitions
+}
+
+func propertyDataType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int, int64:
+		return "long"
+	case float64:
+		return "double"
+	default:
+		return "string"
+	}
+}
+
+// Returns the property value as a string, lists are joined with commas.
+func propertyString(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func nodeProperties(graph *graphModel) []map[string]interface{} {
+	var propertiesList []map[string]interface{}
+	for _, node := range graph.nodes {
+		propertiesList = append(propertiesList, node.properties)
+	}
+	return propertiesList
+}
+
+func edgeProperties(graph *graphModel) []map[string]interface{} {
+	var propertiesList []map[string]interface{}
+	for _, edge := range graph.edges {
+		propertiesList = append(propertiesList, edge.properties)
+	}
+	return propertiesList
+}
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	Id         string                 `json:"id"`
+	Label      string                 `json:"label"`
+	Name       string                 `json:"name"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type jsonEdge struct {
+	Id         string                 `json:"id"`
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func getJsonGraph(graph *graphModel) *jsonGraph {
+	ids := exportNodeIds(graph)
+	exported := &jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+	for _, node := range graph.nodes {
+		exported.Nodes = append(exported.Nodes, jsonNode{Id: ids[node], Label: node.label, Name: node.displayName(), Properties: node.properties})
+	}
+	for i, edge := range graph.edges {
+		exported.Edges = append(exported.Edges, jsonEdge{Id: "e" + strconv.Itoa(i), Source: ids[edge.from], Target: ids[edge.to],
+			Type: edge.relType, Properties: edge.properties})
+	}
+	return exported
+}
+
+// Exports the graph as a JSON node and edge list.
+func exportJson(w io.Writer, graph *graphModel) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(getJsonGraph(graph))
+}
+
+// Exports the graph in the Graphviz DOT language. Nodes are colored by their label, and unsafe repositories are red.
+func exportDot(w io.Writer, graph *graphModel) error {
+	bw := bufio.NewWriter(w)
+	ids := exportNodeIds(graph)
+	fmt.Fprintln(bw, "digraph stechhelm {")
+	fmt.Fprintln(bw, "  node [style=filled];")
+	for _, node := range graph.nodes {
+		attributes := []string{
+			dotAttribute("label", node.label+"\n"+node.displayName()),
+			dotAttribute("fillcolor", nodeColor(node)),
+			dotAttribute("node_label", node.label),
+		}
+		for _, name := range sortedPropertyNames(node.properties) {
+			attributes = append(attributes, dotAttribute(name, propertyString(node.properties[name])))
+		}
+		fmt.Fprintf(bw, "  %s [%s];\n", ids[node], strings.Join(attributes, ", "))
+	}
+	for _, edge := range graph.edges {
+		attributes := []string{dotAttribute("label", edge.relType)}
+		for _, name := range sortedPropertyNames(edge.properties) {
+			attributes = append(attributes, dotAttribute(name, propertyString(edge.properties[name])))
+		}
+		fmt.Fprintf(bw, "  %s -> %s [%s];\n", ids[edge.from], ids[edge.to], strings.Join(attributes, ", "))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotAttribute(name, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value))
+}
+
+func nodeColor(node *graphNode) string {
+	if safe, ok := node.properties["is_safe"].(bool); ok && !safe {
+		return "#e74c3c"
+	}
+	switch node.label {
+	case labelAttacker:
+		return "#c0392b"
+	case labelRepoRemote:
+		return "#f39c12"
+	case labelRepoLocal:
+		return "#27ae60"
+	case labelRepoVirtual:
+		return "#2980b9"
+	case labelBuild:
+		return "#8e44ad"
+	case labelBinary:
+		return "#95a5a6"
+	case labelVulnerability:
+		return "#d35400"
+	case labelComponent:
+		return "#16a085"
+	case labelReleaseBundle:
+		return "#2c3e50"
+	case labelImage:
+		return "#1abc9c"
+	case labelLayer:
+		return "#7f8c8d"
+	case labelUpstream:
+		return "#e74c3c"
+	default:
+		return "#bdc3c7"
+	}
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	Id       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Id     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Exports the graph as GraphML. The node label and relationship type are exported as the "label" and "type" data keys.
+func exportGraphML(w io.Writer, graph *graphModel) error {
+	document := graphMLDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{Id: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{Id: "type", For: "edge", AttrName: "type", AttrType: "string"},
+		},
+		Graph: graphMLGraph{Id: "stechhelm", EdgeDefault: "directed"},
+	}
+	for _, definition := range propertyDefinitions(nodeProperties(graph)) {
+		document.Keys = append(document.Keys, graphMLKey{Id: "n_" + definition.name, For: "node", AttrName: definition.name, AttrType: definition.dataType})
+	}
+	for _, definition := range propertyDefinitions(edgeProperties(graph)) {
+		document.Keys = append(document.Keys, graphMLKey{Id: "e_" + definition.name, For: "edge", AttrName: definition.name, AttrType: definition.dataType})
+	}
+	ids := exportNodeIds(graph)
+	for _, node := range graph.nodes {
+		exported := graphMLNode{Id: ids[node], Data: []graphMLData{{Key: "label", Value: node.label}}}
+		for _, name := range sortedPropertyNames(node.properties) {
+			exported.Data = append(exported.Data, graphMLData{Key: "n_" + name, Value: propertyString(node.properties[name])})
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, exported)
+	}
+	for i, edge := range graph.edges {
+		exported := graphMLEdge{Id: "e" + strconv.Itoa(i), Source: ids[edge.from], Target: ids[edge.to], Data: []graphMLData{{Key: "type", Value: edge.relType}}}
+		for _, name := range sortedPropertyNames(edge.properties) {
+			exported.Data = append(exported.Data, graphMLData{Key: "e_" + name, Value: propertyString(edge.properties[name])})
+		}
+		document.Graph.Edges = append(document.Graph.Edges, exported)
+	}
+	return writeXml(w, document)
+}
+
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	Id    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	Id        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	Id        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Exports the graph as GEXF 1.2. The node label is exported as the "node_label" attribute, and the relationship type as the edge label.
+func exportGexf(w io.Writer, graph *graphModel) error {
+	nodeAttributes := gexfAttributes{Class: "node", Attributes: []gexfAttribute{{Id: "node_label", Title: "node_label", Type: "string"}}}
+	for _, definition := range propertyDefinitions(nodeProperties(graph)) {
+		nodeAttributes.Attributes = append(nodeAttributes.Attributes, gexfAttribute{Id: definition.name, Title: definition.name, Type: definition.dataType})
+	}
+	edgeAttributes := gexfAttributes{Class: "edge"}
+	for _, definition := range propertyDefinitions(edgeProperties(graph)) {
+		edgeAttributes.Attributes = append(edgeAttributes.Attributes, gexfAttribute{Id: definition.name, Title: definition.name, Type: definition.dataType})
+	}
+	document := gexfDocument{
+		Xmlns:   "http://gexf.net/1.2",
+		Version: "1.2",
+		Graph:   gexfGraph{DefaultEdgeType: "directed", Attributes: []gexfAttributes{nodeAttributes, edgeAttributes}},
+	}
+	ids := exportNodeIds(graph)
+	for _, node := range graph.nodes {
+		exported := gexfNode{Id: ids[node], Label: node.displayName(), AttValues: []gexfAttValue{{For: "node_label", Value: node.label}}}
+		for _, name := range sortedPropertyNames(node.properties) {
+			exported.AttValues = append(exported.AttValues, gexfAttValue{For: name, Value: propertyString(node.properties[name])})
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, exported)
+	}
+	for i, edge := range graph.edges {
+		exported := gexfEdge{Id: "e" + strconv.Itoa(i), Source: ids[edge.from], Target: ids[edge.to], Label: edge.relType}
+		for _, name := range sortedPropertyNames(edge.properties) {
+			exported.AttValues = append(exported.AttValues, gexfAttValue{For: name, Value: propertyString(edge.properties[name])})
+		}
+		document.Graph.Edges = append(document.Graph.Edges, exported)
+	}
+	return writeXml(w, document)
+}
+
+func writeXml(w io.Writer, document interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
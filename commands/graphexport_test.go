@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func getTestExportGraph() *graphModel {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, false, false, true)
+	gb.graphCreateVirtualRepoNode(`virtual"1`, "VIRTUAL", false, false, false, false, false)
+	gb.graphCreateRelationshipVirtualToLocalOrRemote(`virtual"1`, "remote1")
+	return gb.graph
+}
+
+func TestExportJson(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, exportGraph(&buffer, getTestExportGraph(), formatJson))
+	exported := &jsonGraph{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), exported))
+	if assert.Len(t, exported.Nodes, 3) && assert.Len(t, exported.Edges, 2) {
+		assert.Equal(t, "n0", exported.Nodes[0].Id)
+		assert.Equal(t, labelRepoRemote, exported.Nodes[0].Label)
+		assert.Equal(t, "remote1", exported.Nodes[0].Name)
+		assert.Equal(t, true, exported.Nodes[0].Properties["is_xray"])
+		assert.Equal(t, labelRepoVirtual, exported.Nodes[2].Label)
+		assert.Equal(t, false, exported.Nodes[2].Properties["is_safe"])
+		assert.Equal(t, jsonEdge{Id: "e1", Source: "n0", Target: "n2", Type: relLinkedTo, Properties: map[string]interface{}{}}, exported.Edges[1])
+	}
+}
+
+func TestExportDot(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, exportGraph(&buffer, getTestExportGraph(), formatDot))
+	dot := buffer.String()
+	assert.Contains(t, dot, "digraph stechhelm {\n")
+	assert.Contains(t, dot, `n0 [label="RepoREMOTE\nremote1", fillcolor="#f39c12", node_label="RepoREMOTE", is_exc="false", is_inc="false", is_priority="false", is_xray="true", name="remote1", type="REMOTE"];`)
+	assert.Contains(t, dot, `label="RepoVIRTUAL\nvirtual\"1", fillcolor="#e74c3c"`)
+	assert.Contains(t, dot, `n1 -> n0 [label="ATTACKS"];`)
+	assert.Contains(t, dot, `n0 -> n2 [label="LINKED_TO"];`)
+}
+
+func TestExportGraphML(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, exportGraph(&buffer, getTestExportGraph(), formatGraphML))
+	exported := &graphMLDocument{}
+	assert.NoError(t, xml.Unmarshal(buffer.Bytes(), exported))
+	assert.Contains(t, exported.Keys, graphMLKey{Id: "n_is_safe", For: "node", AttrName: "is_safe", AttrType: "boolean"})
+	assert.Contains(t, exported.Keys, graphMLKey{Id: "n_name", For: "node", AttrName: "name", AttrType: "string"})
+	if assert.Len(t, exported.Graph.Nodes, 3) && assert.Len(t, exported.Graph.Edges, 2) {
+		assert.Contains(t, exported.Graph.Nodes[2].Data, graphMLData{Key: "label", Value: labelRepoVirtual})
+		assert.Contains(t, exported.Graph.Nodes[2].Data, graphMLData{Key: "n_name", Value: `virtual"1`})
+		assert.Contains(t, exported.Graph.Nodes[2].Data, graphMLData{Key: "n_is_safe", Value: "false"})
+		assert.Equal(t, "n2", exported.Graph.Edges[1].Target)
+		assert.Equal(t, []graphMLData{{Key: "type", Value: relLinkedTo}}, exported.Graph.Edges[1].Data)
+	}
+}
+
+func TestExportGexf(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, exportGraph(&buffer, getTestExportGraph(), formatGexf))
+	exported := &gexfDocument{}
+	assert.NoError(t, xml.Unmarshal(buffer.Bytes(), exported))
+	assert.Equal(t, "1.2", exported.Version)
+	if assert.Len(t, exported.Graph.Attributes, 2) {
+		assert.Contains(t, exported.Graph.Attributes[0].Attributes, gexfAttribute{Id: "is_xray", Title: "is_xray", Type: "boolean"})
+	}
+	if assert.Len(t, exported.Graph.Nodes, 3) && assert.Len(t, exported.Graph.Edges, 2) {
+		assert.Equal(t, "attacker", exported.Graph.Nodes[1].Label)
+		assert.Contains(t, exported.Graph.Nodes[1].AttValues, gexfAttValue{For: "node_label", Value: labelAttacker})
+		assert.Equal(t, gexfEdge{Id: "e0", Source: "n1", Target: "n0", Label: relAttacks}, exported.Graph.Edges[0])
+	}
+}
+
+func TestGraphOutputFileName(t *testing.T) {
+	assert.Equal(t, "out", graphOutputFileName("out", formatCypher))
+	assert.Equal(t, "out.graphml", graphOutputFileName("out", formatGraphML))
+	assert.Equal(t, "out.json", graphOutputFileName("out.json", formatJson))
+	assert.Equal(t, "out.json.dot", graphOutputFileName("out.json", formatDot))
+}
+
+func TestGetHtmlViewerData(t *testing.T) {
+	data := getHtmlViewerData(getTestAttackGraph().graph)
+	assert.Len(t, data.Nodes, len(getTestAttackGraph().graph.nodes))
+	assert.Equal(t, "#e74c3c", data.Nodes[3].Color)
+	assert.Equal(t, "unsafe1", data.Nodes[3].Name)
+	assert.Equal(t, "#2980b9", data.Legend[labelRepoVirtual])
+	// Only build1 and build2 are exposed, through the unsafe virtual repository.
+	if assert.Len(t, data.AttackPaths, 2) {
+		for buildIndex, path := range data.AttackPaths {
+			assert.Equal(t, labelBuild, data.Nodes[buildIndex].Label)
+			assert.Equal(t, relAttacks, data.Edges[path[0]].Type)
+			assert.Equal(t, buildIndex, data.Edges[path[len(path)-1]].Target)
+		}
+	}
+}
+
+func TestExportHtml(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateRelationshipBuildToArtifact(`</script><script>alert(1)</script>`, "1", "sha1")
+	var buffer bytes.Buffer
+	assert.NoError(t, exportGraph(&buffer, gb.graph, formatHtml))
+	page := buffer.String()
+	assert.NotContains(t, page, "{{GRAPH_DATA}}")
+	assert.Equal(t, 1, strings.Count(page, "</script>"))
+	assert.Contains(t, page, `\u003c/script\u003e\u003cscript\u003ealert(1)`)
+}
@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	labelAttacker      = "Attacker"
+	labelBinary        = "Binary"
+	labelBuild         = "Build"
+	labelRepoLocal     = "RepoLOCAL"
+	labelRepoRemote    = "RepoREMOTE"
+	labelRepoVirtual   = "RepoVIRTUAL"
+	labelVulnerability = "Vulnerability"
+	labelComponent     = "Component"
+	labelReleaseBundle = "ReleaseBundle"
+	labelImage         = "Image"
+	labelLayer         = "Layer"
+	labelUpstream      = "Upstream"
+
+	relAttacks       = "ATTACKS"
+	relLinkedTo      = "LINKED_TO"
+	relStores        = "STORES"
+	relDependencyFor = "DEPENDENCY_FOR"
+	relProduce       = "PRODUCE"
+	relNextBuild     = "NEXT_BUILD"
+	relAffectedBy    = "AFFECTED_BY"
+	relProvides      = "PROVIDES"
+	relRequestedBy   = "REQUESTED_BY"
+	relContains      = "CONTAINS"
+	relFromBuild     = "FROM_BUILD"
+	relHasLayer      = "HAS_LAYER"
+	relBaseImageFor  = "BASE_IMAGE_FOR"
+	relUpstreamOf    = "UPSTREAM_OF"
+)
+
+var repoLabels = []string{labelRepoLocal, labelRepoRemote, labelRepoVirtual}
+
+// All the labels of the graph nodes.
+var graphLabels = []string{labelAttacker, labelUpstream, labelRepoLocal, labelRepoRemote, labelRepoVirtual, labelBinary, labelBuild,
+	labelVulnerability, labelComponent, labelReleaseBundle, labelImage, labelLayer}
+
+// A node of the graph. The key properties identify the node among the nodes with the same label.
+type graphNode struct {
+	id         string
+	label      string
+	keys       []string
+	properties map[string]interface{}
+}
+
+// Returns the values of the key properties only.
+func (gn *graphNode) keyProperties() map[string]interface{} {
+	keyProperties := map[string]interface{}{}
+	for _, key := range gn.keys {
+		keyProperties[key] = gn.properties[key]
+	}
+	return keyProperties
+}
+
+// Returns all the properties, except for the key properties.
+func (gn *graphNode) otherProperties() map[string]interface{} {
+	otherProperties := map[string]interface{}{}
+	for name, value := range gn.properties {
+		if !containsString(gn.keys, name) {
+			otherProperties[name] = value
+		}
+	}
+	return otherProperties
+}
+
+// Returns a human readable name of the node, e.g. the repository name or build name and number.
+func (gn *graphNode) displayName() string {
+	var values []string
+	for _, key := range gn.keys {
+		values = append(values, fmt.Sprint(gn.properties[key]))
+	}
+	return strings.Join(values, "/")
+}
+
+type graphEdge struct {
+	relType    string
+	from       *graphNode
+	to         *graphNode
+	properties map[string]interface{}
+}
+
+// An in-memory graph, populated by the collectors and consumed by the exporters and writers.
+// Nodes and edges keep the order in which they were first added.
+type graphModel struct {
+	nodes    []*graphNode
+	nodeById map[string]*graphNode
+	edges    []*graphEdge
+	edgeById map[string]*graphEdge
+}
+
+func newGraphModel() *graphModel {
+	return &graphModel{
+		nodeById: map[string]*graphNode{},
+		edgeById: map[string]*graphEdge{},
+	}
+}
+
+// Returns the node id. Values are separated by a NUL character, which can't appear in names.
+func nodeId(label string, keyValues ...interface{}) string {
+	id := label
+	for _, value := range keyValues {
+		id += "\x00" + fmt.Sprint(value)
+	}
+	return id
+}
+
+// Adds a node identified by its label and key properties. If the node already exists, its properties are updated.
+func (gm *graphModel) addNode(label string, properties map[string]interface{}, keys ...string) *graphNode {
+	var keyValues []interface{}
+	for _, key := range keys {
+		keyValues = append(keyValues, properties[key])
+	}
+	id := nodeId(label, keyValues...)
+	if node, ok := gm.nodeById[id]; ok {
+		for name, value := range properties {
+			node.properties[name] = value
+		}
+		return node
+	}
+	node := &graphNode{id: id, label: label, keys: keys, properties: map[string]interface{}{}}
+	for name, value := range properties {
+		node.properties[name] = value
+	}
+	gm.nodes = append(gm.nodes, node)
+	gm.nodeById[id] = node
+	return node
+}
+
+func (gm *graphModel) getNode(label string, keyValues ...interface{}) *graphNode {
+	return gm.nodeById[nodeId(label, keyValues...)]
+}
+
+func edgeId(relType string, from, to *graphNode) string {
+	return from.id + "\x00" + relType + "\x00" + to.id
+}
+
+// Adds an edge of the given type between the nodes. Returns false if the edge already exists.
+func (gm *graphModel) addEdge(relType string, from, to *graphNode, properties map[string]interface{}) bool {
+	id := edgeId(relType, from, to)
+	if edge, ok := gm.edgeById[id]; ok {
+		for name, value := range properties {
+			edge.properties[name] = value
+		}
+		return false
+	}
+	edge := &graphEdge{relType: relType, from: from, to: to, properties: map[string]interface{}{}}
+	for name, value := range properties {
+		edge.properties[name] = value
+	}
+	gm.edges = append(gm.edges, edge)
+	gm.edgeById[id] = edge
+	return true
+}
+
+func (gm *graphModel) nodeCounts() map[string]int {
+	counts := map[string]int{}
+	for _, node := range gm.nodes {
+		counts[node.label]++
+	}
+	return counts
+}
+
+func (gm *graphModel) edgeCounts() map[string]int {
+	counts := map[string]int{}
+	for _, edge := range gm.edges {
+		counts[edge.relType]++
+	}
+	return counts
+}
+
+// Returns the property names, sorted.
+func sortedPropertyNames(properties map[string]interface{}) []string {
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
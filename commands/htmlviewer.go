@@ -0,0 +1,359 @@
+package commands
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+type htmlViewerData struct {
+	Nodes []htmlViewerNode `json:"nodes"`
+	Edges []htmlViewerEdge `json:"edges"`
+	// The edges of the shortest attack path to each exposed build, by the build node index.
+	AttackPaths map[int][]int `json:"attackPaths"`
+	// The color of each node label, for the legend.
+	Legend map[string]string `json:"legend"`
+}
+
+type htmlViewerNode struct {
+	Label      string                 `json:"label"`
+	Name       string                 `json:"name"`
+	Color      string                 `json:"color"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type htmlViewerEdge struct {
+	Source int    `json:"source"`
+	Target int    `json:"target"`
+	Type   string `json:"type"`
+}
+
+func getHtmlViewerData(graph *graphModel) *htmlViewerData {
+	data := &htmlViewerData{Nodes: []htmlViewerNode{}, Edges: []htmlViewerEdge{}, AttackPaths: map[int][]int{}, Legend: map[string]string{}}
+	nodeIndex := map[*graphNode]int{}
+	for i, node := range graph.nodes {
+		nodeIndex[node] = i
+		data.Legend[node.label] = nodeColor(&graphNode{label: node.label})
+		data.Nodes = append(data.Nodes, htmlViewerNode{Label: node.label, Name: node.displayName(), Color: nodeColor(node), Properties: node.properties})
+	}
+	edgeIndex := map[*graphEdge]int{}
+	for i, edge := range graph.edges {
+		edgeIndex[edge] = i
+		data.Edges = append(data.Edges, htmlViewerEdge{Source: nodeIndex[edge.from], Target: nodeIndex[edge.to], Type: edge.relType})
+	}
+	for _, path := range findAttackPaths(graph, false) {
+		var edges []int
+		for _, edge := range path.edges {
+			edges = append(edges, edgeIndex[edge])
+		}
+		data.AttackPaths[nodeIndex[path.build()]] = edges
+	}
+	return data
+}
+
+// Exports the graph as a single HTML file with an interactive viewer, which works offline.
+func exportHtml(w io.Writer, graph *graphModel) error {
+	// The JSON encoder escapes '<', '>' and '&', so the data can't close the script element.
+	data, err := json.Marshal(getHtmlViewerData(graph))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.Replace(htmlViewerPage, "{{GRAPH_DATA}}", string(data), 1))
+	return err
+}
+
+const htmlViewerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Stechhelm graph</title>
+<style>
+  body { margin: 0; font-family: sans-serif; font-size: 13px; display: flex; height: 100vh; overflow: hidden; }
+  #graph { flex: 1; background: #fafafa; cursor: grab; }
+  #panel { width: 320px; padding: 10px; border-left: 1px solid #ddd; overflow-y: auto; }
+  #search { width: 100%; box-sizing: border-box; padding: 4px; margin-bottom: 10px; }
+  #legend div { margin: 2px 0; }
+  .swatch { display: inline-block; width: 10px; height: 10px; border-radius: 5px; margin-right: 6px; }
+  table { border-collapse: collapse; width: 100%; }
+  td { border-bottom: 1px solid #eee; padding: 2px 4px; word-break: break-all; vertical-align: top; }
+  .edge { stroke: #bbb; stroke-width: 1; }
+  .edge.path { stroke: #e74c3c; stroke-width: 3; }
+  .node circle { stroke: #555; stroke-width: 1; cursor: pointer; }
+  .node.selected circle { stroke: #000; stroke-width: 3; }
+  .node text { font-size: 10px; pointer-events: none; }
+  .dimmed { opacity: 0.15; }
+</style>
+</head>
+<body>
+<svg id="graph">
+  <defs>
+    <marker id="arrow" viewBox="0 0 10 10" refX="18" refY="5" markerWidth="6" markerHeight="6" orient="auto">
+      <path d="M0,0 L10,5 L0,10 z" fill="#999"></path>
+    </marker>
+  </defs>
+  <g id="viewport"></g>
+</svg>
+<div id="panel">
+  <input id="search" type="search" placeholder="Search a repository or build">
+  <div id="legend"></div>
+  <h3 id="title">Click a node to inspect it</h3>
+  <div id="details"></div>
+</div>
+<script>
+(function () {
+  var data = {{GRAPH_DATA}};
+  var svgNs = "http://www.w3.org/2000/svg";
+  var svg = document.getElementById("graph");
+  var viewport = document.getElementById("viewport");
+  var nodes = data.nodes, edges = data.edges;
+  var width = svg.clientWidth || 800, height = svg.clientHeight || 600;
+  var scale = 1, panX = 0, panY = 0;
+  var selected = -1;
+
+  function element(name, attributes, parent) {
+    var e = document.createElementNS(svgNs, name);
+    for (var key in attributes) { e.setAttribute(key, attributes[key]); }
+    parent.appendChild(e);
+    return e;
+  }
+
+  // Legend, by node label.
+  var legend = document.getElementById("legend");
+  function addLegendItem(color, text) {
+    var item = document.createElement("div");
+    item.innerHTML = '<span class="swatch"></span>';
+    item.firstChild.style.background = color;
+    item.appendChild(document.createTextNode(text));
+    legend.appendChild(item);
+  }
+  Object.keys(data.legend).sort().forEach(function (label) { addLegendItem(data.legend[label], label); });
+  addLegendItem("#e74c3c", "Unsafe repository");
+
+  // Initial positions on a circle, so that the layout is the same on every load.
+  nodes.forEach(function (n, i) {
+    var angle = 2 * Math.PI * i / nodes.length, radius = 20 * Math.sqrt(nodes.length);
+    n.x = width / 2 + radius * Math.cos(angle);
+    n.y = height / 2 + radius * Math.sin(angle);
+    n.vx = 0;
+    n.vy = 0;
+  });
+
+  edges.forEach(function (e) {
+    e.element = element("line", {"class": "edge", "marker-end": "url(#arrow)"}, viewport);
+    var title = element("title", {}, e.element);
+    title.textContent = e.type;
+  });
+  nodes.forEach(function (n, i) {
+    n.element = element("g", {"class": "node"}, viewport);
+    element("circle", {r: n.label === "Attacker" ? 12 : 8, fill: n.color}, n.element);
+    var text = element("text", {x: 11, y: 4}, n.element);
+    text.textContent = n.name;
+    n.element.addEventListener("mousedown", function (event) { startDrag(event, i); });
+    n.element.addEventListener("click", function (event) { event.stopPropagation(); select(i); });
+  });
+
+  // Force-directed layout: nodes repel each other, edges pull their nodes together.
+  var alpha = 1;
+  function tick() {
+    var i, j, n, m, dx, dy, distance, force;
+    for (i = 0; i < nodes.length; i++) {
+      n = nodes[i];
+      for (j = i + 1; j < nodes.length; j++) {
+        m = nodes[j];
+        dx = n.x - m.x;
+        dy = n.y - m.y;
+        distance = Math.max(Math.sqrt(dx * dx + dy * dy), 1);
+        force = 800 / (distance * distance);
+        n.vx += dx / distance * force;
+        n.vy += dy / distance * force;
+        m.vx -= dx / distance * force;
+        m.vy -= dy / distance * force;
+      }
+    }
+    edges.forEach(function (e) {
+      var source = nodes[e.source], target = nodes[e.target];
+      dx = target.x - source.x;
+      dy = target.y - source.y;
+      distance = Math.max(Math.sqrt(dx * dx + dy * dy), 1);
+      force = (distance - 60) * 0.02;
+      source.vx += dx / distance * force;
+      source.vy += dy / distance * force;
+      target.vx -= dx / distance * force;
+      target.vy -= dy / distance * force;
+    });
+    nodes.forEach(function (n) {
+      n.vx += (width / 2 - n.x) * 0.002;
+      n.vy += (height / 2 - n.y) * 0.002;
+      if (!n.fixed) {
+        n.x += n.vx * alpha;
+        n.y += n.vy * alpha;
+      }
+      n.vx *= 0.6;
+      n.vy *= 0.6;
+    });
+    alpha *= 0.99;
+  }
+
+  function draw() {
+    edges.forEach(function (e) {
+      var source = nodes[e.source], target = nodes[e.target];
+      e.element.setAttribute("x1", source.x);
+      e.element.setAttribute("y1", source.y);
+      e.element.setAttribute("x2", target.x);
+      e.element.setAttribute("y2", target.y);
+    });
+    nodes.forEach(function (n) {
+      n.element.setAttribute("transform", "translate(" + n.x + "," + n.y + ")");
+    });
+    viewport.setAttribute("transform", "translate(" + panX + "," + panY + ") scale(" + scale + ")");
+  }
+
+  function animate() {
+    if (alpha > 0.005) {
+      tick();
+      draw();
+      requestAnimationFrame(animate);
+    }
+  }
+
+  function restart() {
+    if (alpha <= 0.005) {
+      alpha = 0.3;
+      requestAnimationFrame(animate);
+    } else {
+      alpha = Math.max(alpha, 0.3);
+    }
+  }
+
+  // Dragging nodes, panning and zooming.
+  var dragged = -1, panning = null, panned = false;
+  function toGraph(event) {
+    return {x: (event.clientX - svg.getBoundingClientRect().left - panX) / scale,
+      y: (event.clientY - svg.getBoundingClientRect().top - panY) / scale};
+  }
+  function startDrag(event, i) {
+    event.stopPropagation();
+    dragged = i;
+    nodes[i].fixed = true;
+  }
+  svg.addEventListener("mousedown", function (event) {
+    panning = {x: event.clientX - panX, y: event.clientY - panY};
+    panned = false;
+  });
+  window.addEventListener("mousemove", function (event) {
+    if (dragged >= 0) {
+      var point = toGraph(event);
+      nodes[dragged].x = point.x;
+      nodes[dragged].y = point.y;
+      restart();
+    } else if (panning) {
+      panX = event.clientX - panning.x;
+      panY = event.clientY - panning.y;
+      panned = true;
+      draw();
+    }
+  });
+  window.addEventListener("mouseup", function () {
+    if (dragged >= 0) {
+      nodes[dragged].fixed = false;
+    }
+    dragged = -1;
+    panning = null;
+  });
+  svg.addEventListener("wheel", function (event) {
+    event.preventDefault();
+    var point = toGraph(event), factor = event.deltaY < 0 ? 1.1 : 1 / 1.1;
+    scale *= factor;
+    panX -= point.x * scale - point.x * scale / factor;
+    panY -= point.y * scale - point.y * scale / factor;
+    draw();
+  });
+  svg.addEventListener("click", function () {
+    if (!panned) { select(-1); }
+  });
+
+  // Selection shows the node properties, and the attack path if the node is an exposed build.
+  function highlight(nodeSet, edgeSet) {
+    nodes.forEach(function (n, i) {
+      n.element.classList.toggle("dimmed", nodeSet !== null && !nodeSet[i]);
+      n.element.classList.toggle("selected", i === selected);
+    });
+    edges.forEach(function (e, i) {
+      e.element.classList.toggle("dimmed", nodeSet !== null && !(edgeSet && edgeSet[i]));
+      e.element.classList.toggle("path", !!(edgeSet && edgeSet[i]));
+    });
+  }
+
+  function select(i) {
+    selected = i;
+    var title = document.getElementById("title"), details = document.getElementById("details");
+    details.innerHTML = "";
+    if (i < 0) {
+      title.textContent = "Click a node to inspect it";
+      highlight(null, null);
+      return;
+    }
+    var n = nodes[i];
+    title.textContent = n.label + ": " + n.name;
+    var table = document.createElement("table");
+    Object.keys(n.properties).sort().forEach(function (key) {
+      var row = table.insertRow();
+      row.insertCell().textContent = key;
+      row.insertCell().textContent = String(n.properties[key]);
+    });
+    details.appendChild(table);
+    var nodeSet = {}, edgeSet = {};
+    nodeSet[i] = true;
+    var path = data.attackPaths[i];
+    if (path) {
+      path.forEach(function (e) {
+        edgeSet[e] = true;
+        nodeSet[edges[e].source] = true;
+        nodeSet[edges[e].target] = true;
+      });
+      var exposed = document.createElement("p");
+      exposed.textContent = "Exposed to the attacker through " + path.length + " relationships.";
+      details.appendChild(exposed);
+    } else if (n.label === "Build") {
+      var notExposed = document.createElement("p");
+      notExposed.textContent = "Not exposed to the attacker.";
+      details.appendChild(notExposed);
+    }
+    highlight(nodeSet, edgeSet);
+  }
+
+  // Searching highlights the matching nodes, and Enter selects the first match.
+  var search = document.getElementById("search");
+  function matches() {
+    var query = search.value.trim().toLowerCase(), result = [];
+    if (query === "") { return null; }
+    nodes.forEach(function (n, i) {
+      if (n.name.toLowerCase().indexOf(query) >= 0) { result.push(i); }
+    });
+    return result;
+  }
+  search.addEventListener("input", function () {
+    var found = matches(), nodeSet = null;
+    if (found !== null) {
+      nodeSet = {};
+      found.forEach(function (i) { nodeSet[i] = true; });
+    }
+    highlight(nodeSet, null);
+  });
+  search.addEventListener("keydown", function (event) {
+    var found = matches();
+    if (event.key === "Enter" && found && found.length > 0) {
+      var n = nodes[found[0]];
+      panX = width / 2 - n.x * scale;
+      panY = height / 2 - n.y * scale;
+      select(found[0]);
+      draw();
+    }
+  });
+
+  animate();
+})();
+</script>
+</body>
+</html>
+`
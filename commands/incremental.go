@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-cli-core/v2/utils/coreutils"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Version of the graph written to neo4j. Increase it when the labels, keys, properties or relationships change,
+// so that incremental runs fall back to a full rebuild.
+const graphSchemaVersion = 8
+
+// What the last run wrote to neo4j, persisted between incremental runs.
+type graphRunState struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	GraphUrl      string    `json:"graphUrl"`
+	GraphDatabase string    `json:"graphDatabase"`
+	Timestamp     time.Time `json:"timestamp"`
+	// The latest processed build of each build name.
+	Builds map[string]processedBuild `json:"builds"`
+	// Hashes of the repository configurations, by repository key.
+	Repos map[string]string `json:"repos"`
+	// Hashes of the properties of the written nodes and edges, by their ids.
+	Nodes map[string]string `json:"nodes"`
+	Edges map[string]string `json:"edges"`
+}
+
+type processedBuild struct {
+	Number  string `json:"number"`
+	Started string `json:"started"`
+}
+
+func newGraphRunState(builderConfig *graphBuilderConfig) *graphRunState {
+	return &graphRunState{
+		SchemaVersion: graphSchemaVersion,
+		GraphUrl:      builderConfig.graphUrl,
+		GraphDatabase: builderConfig.graphDatabase,
+		Builds:        map[string]processedBuild{},
+		Repos:         map[string]string{},
+		Nodes:         map[string]string{},
+		Edges:         map[string]string{},
+	}
+}
+
+// Returns the run state stored in the file, or nil if a full rebuild is needed:
+// when the file is missing or unreadable, or was written with another schema version or to another database.
+func loadGraphRunState(path string, builderConfig *graphBuilderConfig) *graphRunState {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Info("No run state found in " + path + ", rebuilding the whole graph")
+		} else {
+			log.Warn("Failed reading run state, rebuilding the whole graph: " + err.Error())
+		}
+		return nil
+	}
+	state := &graphRunState{}
+	if err = json.Unmarshal(content, state); err != nil {
+		log.Warn("Failed parsing run state file " + path + ", rebuilding the whole graph: " + err.Error())
+		return nil
+	}
+	if state.SchemaVersion != graphSchemaVersion {
+		log.Info(fmt.Sprintf("The graph schema changed from version %d to %d, rebuilding the whole graph", state.SchemaVersion, graphSchemaVersion))
+		return nil
+	}
+	if state.GraphUrl != builderConfig.graphUrl || state.GraphDatabase != builderConfig.graphDatabase {
+		log.Info("The run state was written to another graph database, rebuilding the whole graph")
+		return nil
+	}
+	if state.Builds == nil {
+		state.Builds = map[string]processedBuild{}
+	}
+	if state.Repos == nil {
+		state.Repos = map[string]string{}
+	}
+	if state.Nodes == nil {
+		state.Nodes = map[string]string{}
+	}
+	if state.Edges == nil {
+		state.Edges = map[string]string{}
+	}
+	return state
+}
+
+func saveGraphRunState(path string, state *graphRunState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// Returns the run state file of the server, unless one was provided.
+func getRunStatePath(builderConfig *graphBuilderConfig, serverId string) (string, error) {
+	if builderConfig.runStateFile != "" {
+		return builderConfig.runStateFile, nil
+	}
+	homeDir, err := coreutils.GetJfrogHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if serverId == "" {
+		serverId = "default"
+	}
+	return filepath.Join(homeDir, "stechhelm", "runs", unsafeFileNameRegExp.ReplaceAllString(serverId, "_")+".json"), nil
+}
+
+// Returns true if no build of the build name started since the last processed one.
+func (rs *graphRunState) isBuildProcessed(build *Build) bool {
+	if rs == nil {
+		return false
+	}
+	processed, ok := rs.Builds[build.name()]
+	if !ok || build.LastStarted == "" {
+		return false
+	}
+	return !build.lastStartedTime().After(parseBuildTime(processed.Started))
+}
+
+// Returns the runs which started after the last processed run of the build name.
+func (rs *graphRunState) newRuns(buildName string, runs []BuildRun) []BuildRun {
+	if rs == nil {
+		return runs
+	}
+	processed, ok := rs.Builds[buildName]
+	if !ok {
+		return runs
+	}
+	processedStarted := parseBuildTime(processed.Started)
+	var newRuns []BuildRun
+	for _, run := range runs {
+		if run.number() != processed.Number && run.startedTime().After(processedStarted) {
+			newRuns = append(newRuns, run)
+		}
+	}
+	return newRuns
+}
+
+// Returns the last processed build of the build name, if any.
+func (rs *graphRunState) lastBuild(buildName string) (processedBuild, bool) {
+	if rs == nil {
+		return processedBuild{}, false
+	}
+	processed, ok := rs.Builds[buildName]
+	return processed, ok
+}
+
+// Returns the state to store after this run. Builds, nodes and edges of the previous run are kept,
+// since an incremental run only collects the new builds.
+func (gb *GraphBuilder) nextRunState() *graphRunState {
+	next := newGraphRunState(gb.builderConfig)
+	next.Timestamp = time.Now()
+	if gb.runState != nil {
+		for name, build := range gb.runState.Builds {
+			next.Builds[name] = build
+		}
+		for id, hash := range gb.runState.Nodes {
+			next.Nodes[id] = hash
+		}
+		for id, hash := range gb.runState.Edges {
+			next.Edges[id] = hash
+		}
+	}
+	for name, build := range gb.processedBuilds {
+		next.Builds[name] = build
+	}
+	for key, hash := range gb.repoHashes {
+		next.Repos[key] = hash
+	}
+	return next
+}
+
+// Fetches the configuration of the repository into repositoryConfig, and records its hash.
+// Repository configurations are always fetched, since Artifactory doesn't tell when they change,
+// and changes such as the members of a virtual repository don't show in the repositories list.
+func (gb *GraphBuilder) collectRepositoryConfig(repoKey string, repositoryConfig interface{}) error {
+	if err := gb.getRepositoryConfig(repoKey, repositoryConfig); err != nil {
+		return err
+	}
+	gb.repoHashes[repoKey] = hashJson(repositoryConfig)
+	return nil
+}
+
+// Returns the keys of the repositories which were added or changed since the last run, sorted.
+func (gb *GraphBuilder) changedRepos() []string {
+	var changedRepos []string
+	for key, hash := range gb.repoHashes {
+		if gb.runState == nil || gb.runState.Repos[key] != hash {
+			changedRepos = append(changedRepos, key)
+		}
+	}
+	sort.Strings(changedRepos)
+	return changedRepos
+}
+
+// Returns the names of the builds linked to the binaries of the checksums, which produced or depend on them.
+func (gb *GraphBuilder) getChecksumsBuilds(sha1s []string) map[string]bool {
+	buildNames := map[string]bool{}
+	if len(sha1s) == 0 {
+		return buildNames
+	}
+	checksums := map[string]bool{}
+	for _, sha1 := range sha1s {
+		checksums[sha1] = true
+	}
+	for _, edge := range gb.graph.edges {
+		if edge.relType == relProduce && edge.to.label == labelBinary && checksums[fmt.Sprint(edge.to.properties["sha1"])] {
+			buildNames[fmt.Sprint(edge.from.properties["name"])] = true
+		}
+		if edge.relType == relDependencyFor && edge.from.label == labelBinary && edge.to.label == labelBuild &&
+			checksums[fmt.Sprint(edge.from.properties["sha1"])] {
+			buildNames[fmt.Sprint(edge.to.properties["name"])] = true
+		}
+	}
+	return buildNames
+}
+
+// Returns the part of the graph which is not written in the database yet: the nodes and edges which are new,
+// or whose properties changed since the last run. The hashes of the graph elements are recorded in the next state.
+func getChangedGraph(graph *graphModel, previous, next *graphRunState) *graphModel {
+	changed := newGraphModel()
+	for _, node := range graph.nodes {
+		hash := hashJson(node.properties)
+		if previous == nil || previous.Nodes[node.id] != hash {
+			changed.nodes = append(changed.nodes, node)
+			changed.nodeById[node.id] = node
+		}
+		next.Nodes[node.id] = hash
+	}
+	for _, edge := range graph.edges {
+		id := edgeId(edge.relType, edge.from, edge.to)
+		hash := hashJson(edge.properties)
+		if previous == nil || previous.Edges[id] != hash {
+			changed.edges = append(changed.edges, edge)
+			changed.edgeById[id] = edge
+		}
+		next.Edges[id] = hash
+	}
+	return changed
+}
+
+// Returns a short hash of the value JSON. Maps are marshalled with sorted keys, so equal values have equal hashes.
+func hashJson(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:8])
+}
+
+func getIncrementalFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name: "incremental",
+			Description: "[Default: false] Set to true to only collect the builds added since the last run, and only write the changed " +
+				"repositories, nodes and relationships to neo4j. The whole graph is rebuilt when the run state is missing " +
+				"or the graph schema changed. The graph is not written to files in incremental runs.",
+			DefaultValue: false,
+		},
+		components.StringFlag{
+			Name:        "run-state-file",
+			Description: "[Default: ~/.jfrog/stechhelm/runs/<server ID>.json] Path to the file keeping the state of the last incremental run.",
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadGraphRunState(t *testing.T) {
+	builderConfig := &graphBuilderConfig{graphUrl: "bolt://localhost:7687", graphDatabase: "neo4j"}
+	path := filepath.Join(t.TempDir(), "runs", "state.json")
+	assert.Nil(t, loadGraphRunState(path, builderConfig))
+
+	state := newGraphRunState(builderConfig)
+	state.Builds["app"] = processedBuild{Number: "2", Started: "2021-02-01T10:00:00.000+0000"}
+	assert.NoError(t, saveGraphRunState(path, state))
+	loaded := loadGraphRunState(path, builderConfig)
+	if assert.NotNil(t, loaded) {
+		assert.Equal(t, state.Builds, loaded.Builds)
+	}
+	assert.Nil(t, loadGraphRunState(path, &graphBuilderConfig{graphUrl: "bolt://other:7687", graphDatabase: "neo4j"}))
+
+	state.SchemaVersion = graphSchemaVersion + 1
+	assert.NoError(t, saveGraphRunState(path, state))
+	assert.Nil(t, loadGraphRunState(path, builderConfig))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	assert.Nil(t, loadGraphRunState(path, builderConfig))
+}
+
+func TestGetChangedGraph(t *testing.T) {
+	graph := newGraphModel()
+	attacker := graph.addNode(labelAttacker, map[string]interface{}{"name": "attacker"}, "name")
+	remote := graph.addNode(labelRepoRemote, map[string]interface{}{"name": "remote1", "is_xray": false}, "name")
+	graph.addEdge(relAttacks, attacker, remote, nil)
+
+	first := newGraphRunState(&graphBuilderConfig{})
+	changed := getChangedGraph(graph, nil, first)
+	assert.Len(t, changed.nodes, 2)
+	assert.Len(t, changed.edges, 1)
+
+	remote.properties["is_xray"] = true
+	virtual := graph.addNode(labelRepoVirtual, map[string]interface{}{"name": "virtual1"}, "name")
+	graph.addEdge(relLinkedTo, remote, virtual, nil)
+	second := newGraphRunState(&graphBuilderConfig{})
+	changed = getChangedGraph(graph, first, second)
+	assert.Equal(t, []*graphNode{remote, virtual}, changed.nodes)
+	assert.Equal(t, map[string]int{relLinkedTo: 1}, changed.edgeCounts())
+
+	changed = getChangedGraph(graph, second, newGraphRunState(&graphBuilderConfig{}))
+	assert.Empty(t, changed.nodes)
+	assert.Empty(t, changed.edges)
+}
+
+func TestHandleBuildsIncremental(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{
+		"/api/build/app": `{"buildsNumbers": [
+			{"uri": "/1", "started": "2021-01-01T10:00:00.000+0000"},
+			{"uri": "/2", "started": "2021-02-01T10:00:00.000+0000"},
+			{"uri": "/3", "started": "2021-03-01T10:00:00.000+0000"}]}`,
+		"/api/build/app/3": `{"buildInfo": {"name": "app", "number": "3", "started": "2021-03-01T10:00:00.000+0000"}}`,
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.runState = newGraphRunState(gb.builderConfig)
+	gb.runState.Builds["app"] = processedBuild{Number: "2", Started: "2021-02-01T10:00:00.000+0000"}
+	gb.runState.Builds["lib"] = processedBuild{Number: "7", Started: "2021-02-01T10:00:00.000+0000"}
+
+	assert.NoError(t, gb.handleBuilds([]Build{
+		{Uri: "/app", LastStarted: "2021-03-01T10:00:00.000+0000"},
+		{Uri: "/lib", LastStarted: "2021-02-01T10:00:00.000+0000"},
+	}))
+	assert.Nil(t, gb.graph.getNode(labelBuild, "app", "1"))
+	build2 := gb.graph.getNode(labelBuild, "app", "2")
+	build3 := gb.graph.getNode(labelBuild, "app", "3")
+	if assert.NotNil(t, build2) && assert.NotNil(t, build3) {
+		assert.Contains(t, gb.graph.edgeById, edgeId(relNextBuild, build2, build3))
+	}
+	assert.Nil(t, gb.graph.getNode(labelBuild, "lib", "7"))
+	assert.Equal(t, map[string]processedBuild{"app": {Number: "3", Started: "2021-03-01T10:00:00.000+0000"}}, gb.processedBuilds)
+
+	next := gb.nextRunState()
+	assert.Equal(t, "3", next.Builds["app"].Number)
+	assert.Equal(t, "7", next.Builds["lib"].Number)
+}
+
+func TestHandleBuildsIncrementalFailedLookups(t *testing.T) {
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/build/app":
+			_, _ = w.Write([]byte(`{"buildsNumbers": [{"uri": "/2", "started": "2021-02-01T10:00:00.000+0000"}]}`))
+		case "/api/build/app/2":
+			_, _ = w.Write([]byte(`{"buildInfo": {"name": "app", "number": "2", "started": "2021-02-01T10:00:00.000+0000",
+				"modules": [{"id": "m", "artifacts": [{"sha1": "sha1"}]}]}}`))
+		case "/api/build/lib":
+			_, _ = w.Write([]byte(`{"buildsNumbers": [{"uri": "/7", "started": "2021-02-01T10:00:00.000+0000"}]}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.runState = newGraphRunState(gb.builderConfig)
+	gb.runState.Builds["app"] = processedBuild{Number: "1", Started: "2021-01-01T10:00:00.000+0000"}
+
+	assert.NoError(t, gb.handleBuilds([]Build{
+		{Uri: "/app", LastStarted: "2021-02-01T10:00:00.000+0000"},
+		{Uri: "/lib", LastStarted: "2021-02-01T10:00:00.000+0000"},
+	}))
+	assert.NotNil(t, gb.graph.getNode(labelBuild, "app", "2"))
+	assert.Empty(t, gb.processedBuilds)
+	assert.Equal(t, "1", gb.nextRunState().Builds["app"].Number)
+}
+
+func TestCollectRepositoryConfigIncremental(t *testing.T) {
+	members := `["local1"]`
+	newBuilder := func() *GraphBuilder {
+		return newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"key": "virtual1", "rclass": "virtual", "packageType": "npm", "repositories": ` + members + `}`))
+		}, &graphBuilderConfig{})
+	}
+	gb := newBuilder()
+	assert.NoError(t, gb.collectRepositoryConfig("virtual1", &VirtualRepositoryDetails{}))
+	assert.Equal(t, []string{"virtual1"}, gb.changedRepos())
+
+	next := newBuilder()
+	next.runState = gb.nextRunState()
+	assert.NoError(t, next.collectRepositoryConfig("virtual1", &VirtualRepositoryDetails{}))
+	assert.Empty(t, next.changedRepos())
+
+	// A member added to the virtual repository doesn't show in the repositories list, but changes the configuration.
+	members = `["local1", "remote1"]`
+	changed := newBuilder()
+	changed.runState = next.nextRunState()
+	repositoryConfig := &VirtualRepositoryDetails{}
+	assert.NoError(t, changed.collectRepositoryConfig("virtual1", repositoryConfig))
+	assert.Equal(t, []string{"local1", "remote1"}, repositoryConfig.Repositories)
+	assert.Equal(t, []string{"virtual1"}, changed.changedRepos())
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Writes the audit results as JUnit XML, so that CI systems can display them as test reports.
+// Each repository is a test case, grouped into a test suite per rclass, and each failed rule is a failure.
+func writeJUnit(w io.Writer, results []auditResult) error {
+	report := junitTestSuites{Name: "stechhelm-audit"}
+	for _, rclass := range sortedRclasses(results) {
+		suite := junitTestSuite{Name: rclass}
+		for _, result := range results {
+			if !strings.EqualFold(result.Repo.Rclass, rclass) {
+				continue
+			}
+			testCase := junitTestCase{Name: result.Repo.Key, ClassName: "stechhelm.audit." + rclass}
+			for _, failure := range result.Failures {
+				testCase.Failures = append(testCase.Failures, junitFailure{
+					Message: failure.Reason,
+					Type:    failure.Rule,
+					Text:    failure.Reason,
+				})
+			}
+			suite.Tests++
+			if result.isAtRisk() {
+				suite.Failures++
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	results := []auditResult{
+		{Repo: CommonRepositoryDetails{Key: "maven-local", Rclass: "local"}},
+		{Repo: CommonRepositoryDetails{Key: "npm-remote", Rclass: "remote"},
+			Failures: []auditFailure{{ruleIncludeExcludePatterns, "No patterns <configured>."}, {ruleXrayIndex, "Not indexed."}}},
+		{Repo: CommonRepositoryDetails{Key: "pypi-remote", Rclass: "remote"}},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, writeJUnit(&out, results))
+	assert.Contains(t, out.String(), xml.Header)
+
+	var report junitTestSuites
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 3, report.Tests)
+	assert.Equal(t, 1, report.Failures)
+	assert.Len(t, report.Suites, 2)
+
+	assert.Equal(t, "local", report.Suites[0].Name)
+	assert.Equal(t, 1, report.Suites[0].Tests)
+	assert.Equal(t, 0, report.Suites[0].Failures)
+	assert.Empty(t, report.Suites[0].TestCases[0].Failures)
+
+	remote := report.Suites[1]
+	assert.Equal(t, "remote", remote.Name)
+	assert.Equal(t, 2, remote.Tests)
+	assert.Equal(t, 1, remote.Failures)
+	assert.Equal(t, "npm-remote", remote.TestCases[0].Name)
+	assert.Equal(t, []junitFailure{
+		{Message: "No patterns <configured>.", Type: ruleIncludeExcludePatterns, Text: "No patterns <configured>."},
+		{Message: "Not indexed.", Type: ruleXrayIndex, Text: "Not indexed."},
+	}, remote.TestCases[0].Failures)
+}
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Writes the audit results as a markdown summary, suitable for pull requests and wiki pages.
+// The output contains no timestamps and is ordered, so that the diff between two runs is readable.
+func writeMarkdown(w io.Writer, results []auditResult) error {
+	bw := bufio.NewWriter(w)
+	atRisk := countAtRisk(results)
+
+	fmt.Fprintln(bw, "# Stechhelm audit summary")
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, "**%d repositories audited, %d at risk.**\n", len(results), atRisk)
+	fmt.Fprintln(bw)
+
+	writeMarkdownTable(bw, []string{"Verdict", "Repositories"}, [][]string{
+		{"At risk", strconv.Itoa(atRisk)},
+		{"Safe", strconv.Itoa(len(results) - atRisk)},
+	})
+	writeMarkdownTable(bw, []string{"Rclass", "Repositories", "At risk"},
+		countByGroup(results, func(result *auditResult) string { return strings.ToLower(result.Repo.Rclass) }))
+	writeMarkdownTable(bw, []string{"Package type", "Repositories", "At risk"},
+		countByGroup(results, func(result *auditResult) string { return strings.ToLower(result.Repo.PackageType) }))
+
+	fmt.Fprintln(bw, "## Repositories at risk")
+	fmt.Fprintln(bw)
+	if atRisk == 0 {
+		fmt.Fprintln(bw, "No repositories at risk.")
+		fmt.Fprintln(bw)
+	} else {
+		var rows [][]string
+		for _, result := range results {
+			if !result.isAtRisk() {
+				continue
+			}
+			var reasons []string
+			for _, failure := range result.Failures {
+				reasons = append(reasons, failure.Reason)
+			}
+			rows = append(rows, []string{"`" + result.Repo.Key + "`", result.Repo.Rclass, result.Repo.PackageType, strings.Join(reasons, "<br>")})
+		}
+		writeMarkdownTable(bw, []string{"Repository", "Rclass", "Package type", "Reasons"}, rows)
+	}
+
+	fmt.Fprintln(bw, "## Details")
+	fmt.Fprintln(bw)
+	for _, rclass := range sortedRclasses(results) {
+		var rows [][]string
+		for _, result := range results {
+			if !strings.EqualFold(result.Repo.Rclass, rclass) {
+				continue
+			}
+			repo := result.Repo
+			if strings.EqualFold(rclass, "virtual") {
+				rows = append(rows, []string{"`" + repo.Key + "`", repo.PackageType, "-", "-", "-", "-", result.verdict()})
+			} else {
+				rows = append(rows, []string{"`" + repo.Key + "`", repo.PackageType,
+					patternsStatus(repo.IncludesPattern != "**/*"), patternsStatus(repo.ExcludesPattern != ""),
+					strconv.FormatBool(repo.PriorityResolution), strconv.FormatBool(repo.XrayIndex), result.verdict()})
+			}
+		}
+		fmt.Fprintln(bw, "<details>")
+		fmt.Fprintf(bw, "<summary>%s repositories (%d)</summary>\n", rclass, len(rows))
+		fmt.Fprintln(bw)
+		writeMarkdownTable(bw, []string{"Repository", "Package type", "Include patterns", "Exclude patterns",
+			"Priority resolution", "Xray index", "Verdict"}, rows)
+		fmt.Fprintln(bw, "</details>")
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+func writeMarkdownTable(w io.Writer, header []string, rows [][]string) {
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = escapeMarkdownCell(cell)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+	fmt.Fprintln(w)
+}
+
+func escapeMarkdownCell(cell string) string {
+	if cell == "" {
+		return "-"
+	}
+	return strings.NewReplacer("|", `\|`, "\n", "<br>").Replace(cell)
+}
+
+func countAtRisk(results []auditResult) int {
+	count := 0
+	for i := range results {
+		if results[i].isAtRisk() {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns a row of [group, total, at risk] for each group, sorted by group name.
+func countByGroup(results []auditResult, groupOf func(result *auditResult) string) [][]string {
+	totals := map[string]int{}
+	atRisk := map[string]int{}
+	for i := range results {
+		group := groupOf(&results[i])
+		totals[group]++
+		if results[i].isAtRisk() {
+			atRisk[group]++
+		}
+	}
+	var groups []string
+	for group := range totals {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	var rows [][]string
+	for _, group := range groups {
+		rows = append(rows, []string{group, strconv.Itoa(totals[group]), strconv.Itoa(atRisk[group])})
+	}
+	return rows
+}
+
+func sortedRclasses(results []auditResult) []string {
+	rclasses := map[string]bool{}
+	for _, result := range results {
+		rclasses[strings.ToLower(result.Repo.Rclass)] = true
+	}
+	var sorted []string
+	for rclass := range rclasses {
+		sorted = append(sorted, rclass)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
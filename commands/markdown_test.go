@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	results := []auditResult{
+		{Repo: CommonRepositoryDetails{Key: "maven-local", Rclass: "local", PackageType: "maven", IncludesPattern: "**/*", XrayIndex: true, PriorityResolution: true}},
+		{Repo: CommonRepositoryDetails{Key: "npm-remote", Rclass: "remote", PackageType: "npm", IncludesPattern: "**/*"},
+			Failures: []auditFailure{{ruleIncludeExcludePatterns, "No include | exclude patterns."}, {ruleXrayIndex, "Not indexed."}}},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, writeMarkdown(&out, results))
+	markdown := out.String()
+
+	assert.Contains(t, markdown, "**2 repositories audited, 1 at risk.**")
+	assert.Contains(t, markdown, "| At risk | 1 |\n| Safe | 1 |")
+	assert.Contains(t, markdown, "| local | 1 | 0 |\n| remote | 1 | 1 |")
+	assert.Contains(t, markdown, "| maven | 1 | 0 |\n| npm | 1 | 1 |")
+	assert.Contains(t, markdown, "| `npm-remote` | remote | npm | No include \\| exclude patterns.<br>Not indexed. |")
+	assert.NotContains(t, markdown, "| `maven-local` | local |")
+	assert.Contains(t, markdown, "<summary>local repositories (1)</summary>")
+	assert.Contains(t, markdown, "| `maven-local` | maven | Not configured | Not configured | true | true | Safe |")
+
+	// The output is deterministic.
+	var secondOut bytes.Buffer
+	assert.NoError(t, writeMarkdown(&secondOut, results))
+	assert.Equal(t, markdown, secondOut.String())
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// The queries clearing and pruning the nodes of a label, with the %s placeholder for the label. They match by label, so that
+// neo4j doesn't scan all the nodes.
+const (
+	clearScopeQuery = "MATCH (n:%s) WHERE n.scope = $scope WITH n LIMIT $limit DETACH DELETE n RETURN count(*)"
+	// Relationships are pruned before nodes, since a relationship between two nodes written by this run may be stale.
+	pruneRelationshipsQuery = "MATCH (n:%s)-[r]->() WHERE n.scope = $scope AND (r.run_id IS NULL OR r.run_id <> $run_id) " +
+		"WITH r LIMIT $limit DELETE r RETURN count(*)"
+	pruneNodesQuery = "MATCH (n:%s) WHERE n.scope = $scope AND (n.run_id IS NULL OR n.run_id <> $run_id) " +
+		"WITH n LIMIT $limit DETACH DELETE n RETURN count(*)"
+	// Nodes without a scope were written by versions which didn't scope the graph, and are duplicated by the scoped nodes.
+	deleteUnscopedQuery = "MATCH (n:%s) WHERE n.scope IS NULL WITH n LIMIT $limit DETACH DELETE n RETURN count(*)"
+)
+
+// Writes the graph to neo4j, if neo4j connection details were provided. The graph elements are tagged with the scope and run ID.
+// The scope is cleared before writing if requested, and the elements of the scope which were not written by this run
+// are pruned after writing if requested.
+func populateGraphDb(builderConfig *graphBuilderConfig, graph *graphModel, tags *graphWriteTags) (err error) {
+	if builderConfig.graphUrl == "" {
+		return nil
+	}
+	driver, err := neo4j.NewDriver(builderConfig.graphUrl, neo4j.BasicAuth(builderConfig.graphUser, builderConfig.graphPassword, builderConfig.graphRealm))
+	if err != nil {
+		return err
+	}
+	defer func() { err = closeWithError(driver, err) }()
+	session := driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite, DatabaseName: builderConfig.graphDatabase})
+	defer func() { err = closeWithError(session, err) }()
+	createGraphSchema(session, getSchemaCommands(graph, tags))
+	params := map[string]interface{}{"scope": tags.scope, "run_id": tags.runId, "limit": builderConfig.batchSize}
+	if builderConfig.deleteUnscoped {
+		deleted, err := deleteLabelsInBatches(session, deleteUnscopedQuery, params)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("Deleted %d nodes without a scope from neo4j", deleted))
+	}
+	if builderConfig.clear {
+		deleted, err := deleteLabelsInBatches(session, clearScopeQuery, params)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("Cleared %d nodes of %s from neo4j", deleted, tags.scope))
+	}
+	log.Info("Populating graph data to neo4j, this may take a while...")
+	commands := getCypherCommands(graph, tags)
+	total := len(commands)
+	written, failedChunks := 0, 0
+	for _, batch := range groupCommands(commands) {
+		query := batch.unwindQuery()
+		for _, rows := range chunkRows(batch.rows, builderConfig.batchSize) {
+			_, chunkErr := session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+				_, err := transaction.Run(query, map[string]interface{}{"rows": rows})
+				return nil, err
+			})
+			if chunkErr != nil {
+				// Continue with the rest of the chunks, so that a single failure doesn't leave the graph empty.
+				log.Error(fmt.Sprintf("Failed publishing %d rows of command: %s to graphDB: %s", len(rows), query, chunkErr.Error()))
+				failedChunks++
+				continue
+			}
+			written += len(rows)
+			log.Info(fmt.Sprintf("Written %d/%d graph elements to neo4j", written, total))
+		}
+	}
+	if failedChunks > 0 {
+		// Nothing is pruned, since the elements which failed to be written would be pruned too.
+		return fmt.Errorf("failed writing %d batches to neo4j, %d/%d graph elements were written", failedChunks, written, total)
+	}
+	if builderConfig.prune {
+		return pruneGraphDb(session, params)
+	}
+	return nil
+}
+
+// Creates the constraint, or else the index, of each node label before writing, so that merging and matching
+// the nodes doesn't scan all the nodes. Failures are logged, since the graph can still be written without them.
+func createGraphSchema(session neo4j.Session, commands []schemaCommand) {
+	for _, command := range commands {
+		if command.scopeIndex != "" {
+			if err := runSchemaQuery(session, command.scopeIndex); err != nil {
+				log.Warn(fmt.Sprintf("Could not create the %s scope index, clearing and pruning may be slow: %s", command.label, err.Error()))
+			}
+		}
+		constraintErr := runSchemaQuery(session, command.constraint)
+		if constraintErr == nil {
+			continue
+		}
+		log.Debug(fmt.Sprintf("Could not create the %s constraint, creating an index instead: %s", command.label, constraintErr.Error()))
+		if err := runSchemaQuery(session, command.index); err != nil {
+			log.Warn(fmt.Sprintf("Could not create the %s index, writing may be slow: %s", command.label, err.Error()))
+		}
+	}
+}
+
+// Runs the schema query in its own transaction, since schema changes can't be mixed with writes.
+func runSchemaQuery(session neo4j.Session, query string) error {
+	result, err := session.Run(query, nil)
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume()
+	return err
+}
+
+// Deletes the relationships and nodes of the scope which were not written by this run.
+func pruneGraphDb(session neo4j.Session, params map[string]interface{}) error {
+	relationships, err := deleteLabelsInBatches(session, pruneRelationshipsQuery, params)
+	if err != nil {
+		return err
+	}
+	nodes, err := deleteLabelsInBatches(session, pruneNodesQuery, params)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Pruned %d stale nodes and %d stale relationships from neo4j", nodes, relationships))
+	return nil
+}
+
+// Runs the query of each of the graph labels in batches. Returns the total number of deleted elements.
+func deleteLabelsInBatches(session neo4j.Session, queryFormat string, params map[string]interface{}) (int64, error) {
+	var total int64
+	for _, label := range graphLabels {
+		deleted, err := deleteInBatches(session, fmt.Sprintf(queryFormat, label), params)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Runs the query, deleting up to $limit elements and returning their count, until nothing is deleted.
+// Returns the total number of deleted elements.
+func deleteInBatches(session neo4j.Session, query string, params map[string]interface{}) (int64, error) {
+	var total int64
+	for {
+		deleted, err := session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+			result, err := transaction.Run(query, params)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single()
+			if err != nil {
+				return nil, err
+			}
+			count, _ := record.Values[0].(int64)
+			return count, nil
+		})
+		if err != nil {
+			return total, err
+		}
+		if deleted.(int64) == 0 {
+			return total, nil
+		}
+		total += deleted.(int64)
+	}
+}
+
+func getPruneFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name: "prune",
+			Description: "[Default: false] Set to true to delete the nodes and relationships of the server which were not written by this run " +
+				"from neo4j, such as deleted repositories and removed virtual repository members. Can't be used in incremental mode.",
+			DefaultValue: false,
+		},
+		components.BoolFlag{
+			Name:         "clear",
+			Description:  "[Default: false] Set to true to delete all the nodes and relationships of the server from neo4j before writing the graph.",
+			DefaultValue: false,
+		},
+		components.BoolFlag{
+			Name: "delete-unscoped",
+			Description: "[Default: false] Set to true to delete the nodes without a scope from neo4j before writing the graph, " +
+				"which were written by versions which didn't scope the graph. Deletes them regardless of the server which wrote them.",
+			DefaultValue: false,
+		},
+	}
+}
@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	templateGeneric = "generic"
+	templateSlack   = "slack"
+	templateTeams   = "teams"
+
+	signatureHeader = "X-Stechhelm-Signature"
+	// Maximal number of findings listed in chat messages, to stay within the message size limits.
+	maxChatFindings = 20
+)
+
+var webhookTemplates = []string{templateGeneric, templateSlack, templateTeams}
+
+type webhook struct {
+	url      string
+	template string
+}
+
+// Posts findings changes to webhooks.
+type notifier struct {
+	webhooks  []webhook
+	secret    string
+	retries   int
+	retryWait time.Duration
+	client    *http.Client
+}
+
+// Returns a notifier for the webhook flags, or nil if no webhook is configured.
+func getNotifier(c *components.Context) (*notifier, error) {
+	webhooks, err := parseWebhooks(c.GetStringFlagValue("webhook-url"))
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	retries, err := strconv.Atoi(c.GetStringFlagValue("webhook-retries"))
+	if err != nil || retries < 0 {
+		return nil, errors.New("webhook-retries must be a non-negative number")
+	}
+	return &notifier{
+		webhooks:  webhooks,
+		secret:    c.GetStringFlagValue("webhook-secret"),
+		retries:   retries,
+		retryWait: time.Second,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Parses a comma-separated list of webhooks, each in the form of [template=]url.
+func parseWebhooks(value string) ([]webhook, error) {
+	var webhooks []webhook
+	for _, entry := range splitFlagList(value) {
+		hook := webhook{url: entry, template: templateGeneric}
+		if i := strings.Index(entry, "="); i > 0 && !strings.Contains(entry[:i], "/") {
+			hook.template = entry[:i]
+			hook.url = entry[i+1:]
+			if !containsString(webhookTemplates, hook.template) {
+				return nil, fmt.Errorf("unsupported webhook template '%s', expected one of: %s", hook.template, strings.Join(webhookTemplates, ", "))
+			}
+		}
+		if !strings.HasPrefix(hook.url, "http://") && !strings.HasPrefix(hook.url, "https://") {
+			return nil, fmt.Errorf("invalid webhook URL '%s'", hook.url)
+		}
+		webhooks = append(webhooks, hook)
+	}
+	return webhooks, nil
+}
+
+// Posts the change to all webhooks. Failing webhooks don't prevent posting to the others.
+func (n *notifier) notify(change *findingsChange) error {
+	var failures []string
+	for _, hook := range n.webhooks {
+		payload, err := renderPayload(hook.template, change)
+		if err != nil {
+			return err
+		}
+		if err = n.post(hook.url, payload); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", hook.url, err.Error()))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New("Failed posting to webhooks:\n" + strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+func (n *notifier) post(url string, payload []byte) error {
+	var err error
+	wait := n.retryWait
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			log.Debug(fmt.Sprintf("Retrying webhook %s in %s: %s", url, wait, err.Error()))
+			time.Sleep(wait)
+			wait *= 2
+		}
+		var retryable bool
+		retryable, err = n.postOnce(url, payload)
+		if err == nil || !retryable {
+			return err
+		}
+	}
+	return err
+}
+
+// Returns whether a failed post may succeed when retried.
+func (n *notifier) postOnce(url string, payload []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(signatureHeader, signPayload(n.secret, payload))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, errors.New("unexpected response status: " + resp.Status)
+}
+
+// Returns the HMAC-SHA256 signature of the payload, in the form of sha256=<hex digest>.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func renderPayload(template string, change *findingsChange) ([]byte, error) {
+	switch template {
+	case templateSlack:
+		return json.Marshal(slackPayload(change))
+	case templateTeams:
+		return json.Marshal(teamsPayload(change))
+	default:
+		return json.Marshal(change)
+	}
+}
+
+func changeTitle(change *findingsChange) string {
+	return fmt.Sprintf("Stechhelm %s: %d new, %d resolved findings (%d in total)",
+		change.Source, len(change.New), len(change.Resolved), change.TotalFindings)
+}
+
+// Returns a line per finding, limited to maxChatFindings lines.
+func findingLines(findings []finding, format string) []string {
+	var lines []string
+	for i, f := range findings {
+		if i == maxChatFindings {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(findings)-maxChatFindings))
+			break
+		}
+		lines = append(lines, fmt.Sprintf(format, f.Repo, f.Rule, f.Reason))
+	}
+	return lines
+}
+
+func slackPayload(change *findingsChange) map[string]interface{} {
+	title := changeTitle(change)
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": title},
+		},
+	}
+	for _, section := range []struct {
+		title    string
+		findings []finding
+	}{{"New findings", change.New}, {"Resolved findings", change.Resolved}} {
+		if len(section.findings) == 0 {
+			continue
+		}
+		lines := findingLines(section.findings, "• `%s` (%s): %s")
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": "*" + section.title + "*\n" + strings.Join(lines, "\n")},
+		})
+	}
+	return map[string]interface{}{"text": title, "blocks": blocks}
+}
+
+func teamsPayload(change *findingsChange) map[string]interface{} {
+	body := []interface{}{
+		map[string]interface{}{"type": "TextBlock", "size": "Medium", "weight": "Bolder", "wrap": true, "text": changeTitle(change)},
+	}
+	for _, section := range []struct {
+		title    string
+		findings []finding
+	}{{"New findings", change.New}, {"Resolved findings", change.Resolved}} {
+		if len(section.findings) == 0 {
+			continue
+		}
+		lines := findingLines(section.findings, "- **%s** (%s): %s")
+		body = append(body,
+			map[string]interface{}{"type": "TextBlock", "weight": "Bolder", "text": section.title},
+			map[string]interface{}{"type": "TextBlock", "wrap": true, "text": strings.Join(lines, "\n")})
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    body,
+				},
+			},
+		},
+	}
+}
+
+func getNotifierFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name: "webhook-url",
+			Description: "Comma-separated list of webhook URLs to POST new and resolved findings to. " +
+				"Each URL may be prefixed with a payload template: generic=, slack= or teams=. The default template is generic JSON.",
+		},
+		components.StringFlag{
+			Name:        "webhook-secret",
+			Description: "Secret to sign webhook payloads with. The HMAC-SHA256 signature is sent in the " + signatureHeader + " header.",
+		},
+		components.StringFlag{
+			Name:         "webhook-retries",
+			Description:  "[Default: 3] Number of times to retry a failed webhook call.",
+			DefaultValue: "3",
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestNotifier(urls ...string) *notifier {
+	n := &notifier{retries: 2, retryWait: time.Millisecond, client: &http.Client{Timeout: time.Second}}
+	for _, url := range urls {
+		n.webhooks = append(n.webhooks, webhook{url: url, template: templateGeneric})
+	}
+	return n
+}
+
+func TestParseWebhooks(t *testing.T) {
+	webhooks, err := parseWebhooks("https://example.com/hook?a=b, slack=https://hooks.slack.com/x,teams=http://teams/y")
+	assert.NoError(t, err)
+	assert.Equal(t, []webhook{
+		{url: "https://example.com/hook?a=b", template: templateGeneric},
+		{url: "https://hooks.slack.com/x", template: templateSlack},
+		{url: "http://teams/y", template: templateTeams},
+	}, webhooks)
+
+	_, err = parseWebhooks("discord=https://example.com")
+	assert.Error(t, err)
+	_, err = parseWebhooks("example.com")
+	assert.Error(t, err)
+}
+
+func TestNotifyRetriesAndSigns(t *testing.T) {
+	calls := 0
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(signatureHeader)
+	}))
+	defer server.Close()
+
+	n := newTestNotifier(server.URL)
+	n.secret = "secret"
+	change := &findingsChange{Source: "audit", TotalFindings: 1, findingsDiff: findingsDiff{New: []finding{{Repo: "local1"}}}}
+	assert.NoError(t, n.notify(change))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, signPayload("secret", body), signature)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+}
+
+func TestNotifyDoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	assert.Error(t, newTestNotifier(server.URL).notify(&findingsChange{}))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRenderPayload(t *testing.T) {
+	change := &findingsChange{Source: "graph", TotalFindings: 2, findingsDiff: findingsDiff{
+		New:      []finding{{Repo: "virtual1", Rule: ruleVirtualMembers, Reason: "No priority."}},
+		Resolved: []finding{},
+	}}
+
+	payload, err := renderPayload(templateSlack, change)
+	assert.NoError(t, err)
+	var slack map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &slack))
+	assert.Equal(t, "Stechhelm graph: 1 new, 0 resolved findings (2 in total)", slack["text"])
+	// A header block, and a section for the new findings only.
+	assert.Len(t, slack["blocks"], 2)
+	assert.Contains(t, string(payload), "• `virtual1` (virtual-members): No priority.")
+
+	payload, err = renderPayload(templateTeams, change)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"contentType":"application/vnd.microsoft.card.adaptive"`)
+	assert.Contains(t, string(payload), "- **virtual1** (virtual-members): No priority.")
+
+	payload, err = renderPayload(templateGeneric, change)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"source":"graph"`)
+}
+
+func TestNotifyFindingsChangeOnlyOnChange(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+	tempDir, err := ioutil.TempDir("", "stechhelm-notify")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	stateFile := filepath.Join(tempDir, "state.json")
+	n := newTestNotifier(server.URL)
+	findings := []finding{{Repo: "local1", Rule: ruleXrayIndex, Reason: "Not indexed."}}
+
+	assert.NoError(t, notifyFindingsChange("audit", n, stateFile, findings))
+	assert.Equal(t, 1, calls)
+	// Same findings - no notification.
+	assert.NoError(t, notifyFindingsChange("audit", n, stateFile, findings))
+	assert.Equal(t, 1, calls)
+	// Resolved findings are notified.
+	assert.NoError(t, notifyFindingsChange("audit", n, stateFile, nil))
+	assert.Equal(t, 2, calls)
+}
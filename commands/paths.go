@@ -0,0 +1,284 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The relationships an attack can go through, from the attacker to the builds.
+var attackPathRelTypes = []string{relAttacks, relUpstreamOf, relLinkedTo, relStores, relDependencyFor, relProduce, relBaseImageFor}
+
+var pathsFormats = []string{"table", "json"}
+
+func GetPathsCommand() components.Command {
+	return components.Command{
+		Name:        "paths",
+		Description: "Find the builds exposed to an attacker through remote repositories, without a graph database.",
+		Aliases:     []string{"p"},
+		Arguments:   getPathsArguments(),
+		Flags:       getPathsFlags(),
+		Action: func(c *components.Context) error {
+			return pathsCmd(c)
+		},
+	}
+}
+
+func pathsCmd(c *components.Context) error {
+	if len(c.Arguments) != 0 {
+		return errors.New(fmt.Sprintf("Wrong number of arguments. Expected: 0, Received: %d", len(c.Arguments)))
+	}
+	rtDetails, err := getRtDetails(c)
+	if err != nil {
+		return err
+	}
+	format := c.GetStringFlagValue("format")
+	if !containsString(pathsFormats, format) {
+		return fmt.Errorf("unsupported format '%s', expected one of: %s", format, strings.Join(pathsFormats, ", "))
+	}
+	filter, err := getRepoFilter(c)
+	if err != nil {
+		return err
+	}
+	builderConfig, err := getCollectorConfig(c)
+	if err != nil {
+		return err
+	}
+	graphBuilder, err := newGraphBuilder(rtDetails, builderConfig, filter)
+	if err != nil {
+		return err
+	}
+	if err = graphBuilder.collectGraph(); err != nil {
+		return err
+	}
+	paths := findAttackPaths(graphBuilder.graph, c.GetBoolFlagValue("include-safe-virtuals"))
+	log.Info(fmt.Sprintf("Found %d exposed builds.", len(paths)))
+	if format == "json" {
+		return writeAttackPathsJson(os.Stdout, paths)
+	}
+	printAttackPathsTable(paths)
+	return nil
+}
+
+// The shortest path from the attacker to an exposed build.
+type attackPath struct {
+	nodes []*graphNode
+	edges []*graphEdge
+	// The components from the binary the build depends on, through the components requesting it,
+	// to the direct dependency declared by the build. Empty if the build-info has no component for the binary.
+	dependencyChain []*graphNode
+	// The release bundles created from the build.
+	releaseBundles []*graphNode
+}
+
+func (ap *attackPath) build() *graphNode {
+	return ap.nodes[len(ap.nodes)-1]
+}
+
+func (ap *attackPath) String() string {
+	var sb strings.Builder
+	sb.WriteString(ap.nodes[0].displayName())
+	for _, edge := range ap.edges {
+		sb.WriteString(fmt.Sprintf(" -[%s]-> %s", edge.relType, edge.to.displayName()))
+	}
+	return sb.String()
+}
+
+func (ap *attackPath) dependencyChainNames() []string {
+	var names []string
+	for _, component := range ap.dependencyChain {
+		names = append(names, component.displayName())
+	}
+	return names
+}
+
+func (ap *attackPath) releaseBundleNames() []string {
+	var names []string
+	for _, bundle := range ap.releaseBundles {
+		names = append(names, bundle.displayName())
+	}
+	return names
+}
+
+// Returns the shortest path from the attacker to each of the builds it reaches, sorted by build.
+// Unless includeSafe is set, paths don't go through virtual repositories found safe, which the attacker can't poison.
+func findAttackPaths(graph *graphModel, includeSafe bool) []attackPath {
+	attacker := graph.getNode(labelAttacker, "attacker")
+	if attacker == nil {
+		return nil
+	}
+	outgoing := map[*graphNode][]*graphEdge{}
+	componentEdges := map[*graphNode][]*graphEdge{}
+	bundlesByBuild := map[*graphNode][]*graphNode{}
+	for _, edge := range graph.edges {
+		if containsString(attackPathRelTypes, edge.relType) {
+			outgoing[edge.from] = append(outgoing[edge.from], edge)
+		} else if edge.relType == relProvides || edge.relType == relRequestedBy {
+			componentEdges[edge.from] = append(componentEdges[edge.from], edge)
+		} else if edge.relType == relFromBuild {
+			bundlesByBuild[edge.to] = append(bundlesByBuild[edge.to], edge.from)
+		}
+	}
+	// Breadth first search, keeping the edge each node was first reached by.
+	reachedBy := map[*graphNode]*graphEdge{attacker: nil}
+	queue := []*graphNode{attacker}
+	var builds []*graphNode
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node.label == labelBuild {
+			builds = append(builds, node)
+		}
+		for _, edge := range outgoing[node] {
+			if _, ok := reachedBy[edge.to]; ok {
+				continue
+			}
+			if safe, ok := edge.to.properties["is_safe"].(bool); ok && safe && !includeSafe {
+				continue
+			}
+			reachedBy[edge.to] = edge
+			queue = append(queue, edge.to)
+		}
+	}
+	var paths []attackPath
+	for _, build := range builds {
+		path := attackPath{nodes: []*graphNode{build}, releaseBundles: bundlesByBuild[build]}
+		for edge := reachedBy[build]; edge != nil; edge = reachedBy[edge.from] {
+			path.nodes = append([]*graphNode{edge.from}, path.nodes...)
+			path.edges = append([]*graphEdge{edge}, path.edges...)
+		}
+		if len(path.edges) > 0 && path.edges[len(path.edges)-1].relType == relDependencyFor {
+			path.dependencyChain = findDependencyChain(graph, componentEdges, path.edges[len(path.edges)-1].from, build)
+		}
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].build().displayName() < paths[j].build().displayName()
+	})
+	return paths
+}
+
+// Returns the shortest chain of components from the one provided by the binary to a direct dependency of the build,
+// following the REQUESTED_BY relationships.
+func findDependencyChain(graph *graphModel, componentEdges map[*graphNode][]*graphEdge, binary, build *graphNode) []*graphNode {
+	reachedFrom := map[*graphNode]*graphNode{}
+	var queue []*graphNode
+	for _, edge := range componentEdges[binary] {
+		if edge.relType == relProvides {
+			reachedFrom[edge.to] = nil
+			queue = append(queue, edge.to)
+		}
+	}
+	for len(queue) > 0 {
+		component := queue[0]
+		queue = queue[1:]
+		if _, ok := graph.edgeById[edgeId(relDependencyFor, component, build)]; ok {
+			chain := []*graphNode{component}
+			for from := reachedFrom[component]; from != nil; from = reachedFrom[from] {
+				chain = append([]*graphNode{from}, chain...)
+			}
+			return chain
+		}
+		for _, edge := range componentEdges[component] {
+			if _, ok := reachedFrom[edge.to]; ok || edge.relType != relRequestedBy {
+				continue
+			}
+			reachedFrom[edge.to] = component
+			queue = append(queue, edge.to)
+		}
+	}
+	return nil
+}
+
+func printAttackPathsTable(paths []attackPath) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"#", "Build name", "Build number", "Length", "Shortest path", "Dependency chain", "Release bundles"})
+	for i, path := range paths {
+		build := path.build()
+		t.AppendRow(table.Row{i, build.properties["name"], build.properties["number"], len(path.edges), path.String(),
+			strings.Join(path.dependencyChainNames(), " -> "), strings.Join(path.releaseBundleNames(), ", ")})
+		t.AppendSeparator()
+	}
+	t.AppendFooter(table.Row{"", "", "", "Total exposed", len(paths), "", ""})
+	t.Render()
+}
+
+type attackPathsReport struct {
+	ExposedBuilds int                `json:"exposedBuilds"`
+	Paths         []attackPathReport `json:"paths"`
+}
+
+type attackPathReport struct {
+	BuildName   string           `json:"buildName"`
+	BuildNumber string           `json:"buildNumber"`
+	Length      int              `json:"length"`
+	Path        []attackPathStep `json:"path"`
+	// The components from the exposed dependency to the direct dependency declared by the build.
+	DependencyChain []string `json:"dependencyChain,omitempty"`
+	// The release bundles created from the build, which ship the exposed build.
+	ReleaseBundles []string `json:"releaseBundles,omitempty"`
+}
+
+// A node in the path, with the relationship leading to the next node in the path.
+type attackPathStep struct {
+	Label        string `json:"label"`
+	Name         string `json:"name"`
+	Relationship string `json:"relationship,omitempty"`
+}
+
+func writeAttackPathsJson(w io.Writer, paths []attackPath) error {
+	report := attackPathsReport{ExposedBuilds: len(paths), Paths: []attackPathReport{}}
+	for _, path := range paths {
+		build := path.build()
+		pathReport := attackPathReport{
+			BuildName:       fmt.Sprint(build.properties["name"]),
+			BuildNumber:     fmt.Sprint(build.properties["number"]),
+			Length:          len(path.edges),
+			DependencyChain: path.dependencyChainNames(),
+			ReleaseBundles:  path.releaseBundleNames(),
+		}
+		for i, node := range path.nodes {
+			step := attackPathStep{Label: node.label, Name: node.displayName()}
+			if i < len(path.edges) {
+				step.Relationship = path.edges[i].relType
+			}
+			pathReport.Path = append(pathReport.Path, step)
+		}
+		report.Paths = append(report.Paths, pathReport)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func getPathsArguments() []components.Argument {
+	return []components.Argument{}
+}
+
+func getPathsFlags() []components.Flag {
+	pathsFlags := []components.Flag{
+		components.StringFlag{
+			Name:        "server-id",
+			Description: "Artifactory server ID configured using the config command.",
+		},
+		components.StringFlag{
+			Name:         "format",
+			Description:  "[Default: table] Output format of the exposed builds. Supported values: table, json.",
+			DefaultValue: "table",
+		},
+		components.BoolFlag{
+			Name:         "include-safe-virtuals",
+			Description:  "[Default: false] Set to true to also find paths going through virtual repositories found safe.",
+			DefaultValue: false,
+		},
+	}
+	return joinFlagGroups([][]components.Flag{pathsFlags, getCollectorFlags(), getRepoFilterFlags()})
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getTestAttackGraph() *GraphBuilder {
+	gb := &GraphBuilder{graph: newGraphModel()}
+	gb.graphCreateAttackerNode()
+	gb.graphCreateRepoNode("remote1", "REMOTE", false, false, false, false)
+	gb.graphCreateRepoNode("local1", "LOCAL", true, false, false, true)
+	gb.graphCreateVirtualRepoNode("unsafe1", "VIRTUAL", false, false, false, false, false)
+	gb.graphCreateVirtualRepoNode("safe1", "VIRTUAL", true, false, false, true, true)
+	gb.graphCreateRelationshipVirtualToLocalOrRemote("unsafe1", "remote1")
+	gb.graphCreateRelationshipVirtualToLocalOrRemote("safe1", "remote1")
+	// build1 depends on a binary stored in the unsafe virtual, and produces a binary used by build2.
+	gb.graphCreateRelationshipBinaryToRepo("sha1", "unsafe1")
+	gb.graphCreateRelationshipDependencyToBuild("build1", "1", "sha1")
+	gb.graphCreateRelationshipBuildToArtifact("build1", "1", "sha2")
+	gb.graphCreateRelationshipBinaryToRepo("sha2", "local1")
+	gb.graphCreateRelationshipDependencyToBuild("build2", "7", "sha2")
+	// build3 depends only on a binary stored in the safe virtual.
+	gb.graphCreateRelationshipBinaryToRepo("sha3", "safe1")
+	gb.graphCreateRelationshipDependencyToBuild("build3", "2", "sha3")
+	// build4 isn't reachable from the attacker.
+	gb.graphCreateRelationshipBinaryToRepo("sha4", "local1")
+	gb.graphCreateRelationshipDependencyToBuild("build4", "1", "sha4")
+	return gb
+}
+
+func TestFindAttackPaths(t *testing.T) {
+	paths := findAttackPaths(getTestAttackGraph().graph, false)
+	if assert.Len(t, paths, 2) {
+		assert.Equal(t, "attacker -[ATTACKS]-> remote1 -[LINKED_TO]-> unsafe1 -[STORES]-> sha1 -[DEPENDENCY_FOR]-> build1/1", paths[0].String())
+		assert.Equal(t, "attacker -[ATTACKS]-> remote1 -[LINKED_TO]-> unsafe1 -[STORES]-> sha1 -[DEPENDENCY_FOR]-> build1/1 -[PRODUCE]-> sha2 -[DEPENDENCY_FOR]-> build2/7",
+			paths[1].String())
+	}
+}
+
+func TestFindAttackPathsIncludeSafe(t *testing.T) {
+	paths := findAttackPaths(getTestAttackGraph().graph, true)
+	if assert.Len(t, paths, 3) {
+		assert.Equal(t, "build3/2", paths[2].build().displayName())
+		assert.Equal(t, "attacker -[ATTACKS]-> remote1 -[LINKED_TO]-> safe1 -[STORES]-> sha3 -[DEPENDENCY_FOR]-> build3/2", paths[2].String())
+	}
+}
+
+func TestFindAttackPathsWithoutAttacker(t *testing.T) {
+	assert.Empty(t, findAttackPaths(newGraphModel(), false))
+}
+
+func TestWriteAttackPathsJson(t *testing.T) {
+	var buffer bytes.Buffer
+	paths := findAttackPaths(getTestAttackGraph().graph, false)
+	assert.NoError(t, writeAttackPathsJson(&buffer, paths[:1]))
+	report := &attackPathsReport{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), report))
+	assert.Equal(t, &attackPathsReport{
+		ExposedBuilds: 1,
+		Paths: []attackPathReport{{BuildName: "build1", BuildNumber: "1", Length: 4, Path: []attackPathStep{
+			{Label: labelAttacker, Name: "attacker", Relationship: relAttacks},
+			{Label: labelRepoRemote, Name: "remote1", Relationship: relLinkedTo},
+			{Label: labelRepoVirtual, Name: "unsafe1", Relationship: relStores},
+			{Label: labelBinary, Name: "sha1", Relationship: relDependencyFor},
+			{Label: labelBuild, Name: "build1/1"},
+		}}},
+	}, report)
+}
+
+func TestWriteAttackPathsJsonEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, writeAttackPathsJson(&buffer, nil))
+	assert.JSONEq(t, `{"exposedBuilds": 0, "paths": []}`, buffer.String())
+}
+
+func TestFindAttackPathsDependencyChain(t *testing.T) {
+	gb := getTestAttackGraph()
+	build := gb.graph.getNode(labelBuild, "build1", "1")
+	transitive := gb.graphCreateComponentNode("npm:qs:6.7.0", "npm", "", nil)
+	direct := gb.graphCreateComponentNode("npm:express:4.17.1", "npm", "", nil)
+	gb.graph.addEdge(relProvides, gb.graph.getNode(labelBinary, "sha1"), transitive, nil)
+	gb.graph.addEdge(relRequestedBy, transitive, direct, nil)
+	gb.graph.addEdge(relDependencyFor, direct, build, nil)
+
+	paths := findAttackPaths(gb.graph, false)
+	if assert.Len(t, paths, 2) {
+		assert.Equal(t, []string{"npm:qs:6.7.0", "npm:express:4.17.1"}, paths[0].dependencyChainNames())
+		assert.Empty(t, paths[1].dependencyChain)
+		var buffer bytes.Buffer
+		assert.NoError(t, writeAttackPathsJson(&buffer, paths[:1]))
+		assert.Contains(t, buffer.String(), `"dependencyChain": [`)
+	}
+}
+
+func TestFindAttackPathsReleaseBundles(t *testing.T) {
+	gb := getTestAttackGraph()
+	bundle := gb.graphCreateReleaseBundleNode(&releaseBundle{Name: "bundle1", Version: "1.0", Type: releaseBundleV2})
+	gb.graph.addEdge(relFromBuild, bundle, gb.graph.getNode(labelBuild, "build2", "7"), nil)
+
+	paths := findAttackPaths(gb.graph, false)
+	if assert.Len(t, paths, 2) {
+		assert.Empty(t, paths[0].releaseBundles)
+		assert.Equal(t, []string{"bundle1/1.0/v2"}, paths[1].releaseBundleNames())
+	}
+}
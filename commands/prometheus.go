@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type promMetric struct {
+	name    string
+	help    string
+	samples []promSample
+}
+
+type promSample struct {
+	labels []promLabel
+	value  float64
+}
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+// Writes the metrics in the Prometheus text exposition format.
+// The file is written to a temporary path and then renamed, as expected by the node-exporter textfile collector.
+func writePrometheusFile(path string, metrics []promMetric) error {
+	tempFile, err := os.Create(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"))
+	if err != nil {
+		return errors.New("Failed creating metrics file: " + err.Error())
+	}
+	err = formatPrometheusMetrics(tempFile, metrics)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return errors.New("Failed writing metrics file: " + err.Error())
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+func formatPrometheusMetrics(w io.Writer, metrics []promMetric) error {
+	bw := bufio.NewWriter(w)
+	for _, metric := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric.name)
+		for _, sample := range metric.samples {
+			bw.WriteString(metric.name)
+			if len(sample.labels) > 0 {
+				var labels []string
+				for _, label := range sample.labels {
+					labels = append(labels, fmt.Sprintf(`%s="%s"`, label.name, escapePrometheusLabelValue(label.value)))
+				}
+				bw.WriteString("{" + strings.Join(labels, ",") + "}")
+			}
+			fmt.Fprintf(bw, " %s\n", strconv.FormatFloat(sample.value, 'f', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+func escapePrometheusLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func singleSampleMetric(name, help string, value float64) promMetric {
+	return promMetric{name: name, help: help, samples: []promSample{{value: value}}}
+}
+
+// Returns one sample per label value, sorted by the label value.
+func countsMetric(name, help, labelName string, counts map[string]int) promMetric {
+	var values []string
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	metric := promMetric{name: name, help: help}
+	for _, value := range values {
+		metric.samples = append(metric.samples, promSample{labels: []promLabel{{labelName, value}}, value: float64(counts[value])})
+	}
+	return metric
+}
+
+func getAuditMetrics(results []auditResult, duration time.Duration, now time.Time) []promMetric {
+	atRiskByRule := map[string]int{ruleXrayIndex: 0, rulePriorityResolution: 0, ruleIncludeExcludePatterns: 0, ruleVirtualMembers: 0}
+	atRiskByRclass := map[string]int{}
+	atRiskByPackageType := map[string]int{}
+	atRiskByProject := map[string]int{}
+	repoAtRisk := promMetric{name: "stechhelm_audit_repository_at_risk", help: "Whether the repository is at risk (1) or safe (0)."}
+	for i := range results {
+		result := &results[i]
+		rclass := strings.ToLower(result.Repo.Rclass)
+		packageType := strings.ToLower(result.Repo.PackageType)
+		atRisk := 0
+		if result.isAtRisk() {
+			atRisk = 1
+		}
+		atRiskByRclass[rclass] += atRisk
+		atRiskByPackageType[packageType] += atRisk
+		atRiskByProject[result.Repo.ProjectKey] += atRisk
+		failedRules := map[string]bool{}
+		for _, failure := range result.Failures {
+			failedRules[failure.Rule] = true
+		}
+		for rule := range failedRules {
+			atRiskByRule[rule]++
+		}
+		repoAtRisk.samples = append(repoAtRisk.samples, promSample{
+			labels: []promLabel{{"repo", result.Repo.Key}, {"rclass", rclass}, {"package_type", packageType}, {"project", result.Repo.ProjectKey}},
+			value:  float64(atRisk),
+		})
+	}
+	return []promMetric{
+		singleSampleMetric("stechhelm_audit_repositories", "Number of audited repositories.", float64(len(results))),
+		singleSampleMetric("stechhelm_audit_at_risk_repositories", "Number of repositories at risk.", float64(countAtRisk(results))),
+		countsMetric("stechhelm_audit_at_risk_repositories_by_rule", "Number of repositories failing each audit rule.", "rule", atRiskByRule),
+		countsMetric("stechhelm_audit_at_risk_repositories_by_rclass", "Number of repositories at risk per rclass.", "rclass", atRiskByRclass),
+		countsMetric("stechhelm_audit_at_risk_repositories_by_package_type", "Number of repositories at risk per package type.", "package_type", atRiskByPackageType),
+		countsMetric("stechhelm_audit_at_risk_repositories_by_project", "Number of repositories at risk per project.", "project", atRiskByProject),
+		repoAtRisk,
+		singleSampleMetric("stechhelm_audit_duration_seconds", "Duration of the audit in seconds.", duration.Seconds()),
+		singleSampleMetric("stechhelm_audit_last_run_timestamp_seconds", "Unix time of the last audit run.", float64(now.Unix())),
+	}
+}
+
+func getGraphMetrics(graph *graphModel, collectionDuration, totalDuration time.Duration, now time.Time) []promMetric {
+	return []promMetric{
+		countsMetric("stechhelm_graph_nodes", "Number of graph nodes per label.", "label", graph.nodeCounts()),
+		countsMetric("stechhelm_graph_edges", "Number of graph edges per relationship type.", "type", graph.edgeCounts()),
+		singleSampleMetric("stechhelm_graph_collection_duration_seconds", "Duration of collecting the graph data from Artifactory in seconds.", collectionDuration.Seconds()),
+		singleSampleMetric("stechhelm_graph_duration_seconds", "Duration of the graph creation in seconds.", totalDuration.Seconds()),
+		singleSampleMetric("stechhelm_graph_last_run_timestamp_seconds", "Unix time of the last graph run.", float64(now.Unix())),
+	}
+}
+
+func getMetricsFileFlag() components.Flag {
+	return components.StringFlag{
+		Name:        "metrics-file",
+		Description: "Path to a file to write Prometheus metrics to, in the text exposition format (node-exporter textfile collector compatible).",
+	}
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheusFileAuditMetrics(t *testing.T) {
+	results := []auditResult{
+		{Repo: CommonRepositoryDetails{Key: "maven-local", Rclass: "local", PackageType: "Maven"}},
+		{Repo: CommonRepositoryDetails{Key: "npm-remote", Rclass: "remote", PackageType: "npm", ProjectKey: "proj"},
+			Failures: []auditFailure{{ruleIncludeExcludePatterns, "No patterns."}, {ruleXrayIndex, "Not indexed."}}},
+		{Repo: CommonRepositoryDetails{Key: "npm-virtual", Rclass: "virtual", PackageType: "npm", ProjectKey: "proj"},
+			Failures: []auditFailure{{ruleVirtualMembers, "First reason."}, {ruleVirtualMembers, "Second \"reason\"."}}},
+	}
+	tempDir, err := ioutil.TempDir("", "stechhelm-metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	metricsFile := filepath.Join(tempDir, "stechhelm.prom")
+
+	err = writePrometheusFile(metricsFile, getAuditMetrics(results, 1500*time.Millisecond, time.Unix(1700000000, 0)))
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(metricsFile)
+	assert.NoError(t, err)
+	metrics := string(content)
+
+	assert.Contains(t, metrics, "# HELP stechhelm_audit_repositories Number of audited repositories.\n# TYPE stechhelm_audit_repositories gauge\nstechhelm_audit_repositories 3\n")
+	assert.Contains(t, metrics, "stechhelm_audit_at_risk_repositories 2\n")
+	assert.Contains(t, metrics, "stechhelm_audit_at_risk_repositories_by_rule{rule=\"include-exclude-patterns\"} 1\n"+
+		"stechhelm_audit_at_risk_repositories_by_rule{rule=\"priority-resolution\"} 0\n"+
+		"stechhelm_audit_at_risk_repositories_by_rule{rule=\"virtual-members\"} 1\n"+
+		"stechhelm_audit_at_risk_repositories_by_rule{rule=\"xray-index\"} 1\n")
+	assert.Contains(t, metrics, "stechhelm_audit_at_risk_repositories_by_rclass{rclass=\"local\"} 0\n")
+	assert.Contains(t, metrics, "stechhelm_audit_at_risk_repositories_by_package_type{package_type=\"npm\"} 2\n")
+	assert.Contains(t, metrics, "stechhelm_audit_at_risk_repositories_by_project{project=\"proj\"} 2\n")
+	assert.Contains(t, metrics, "stechhelm_audit_repository_at_risk{repo=\"maven-local\",rclass=\"local\",package_type=\"maven\",project=\"\"} 0\n")
+	assert.Contains(t, metrics, "stechhelm_audit_duration_seconds 1.5\n")
+	assert.Contains(t, metrics, "stechhelm_audit_last_run_timestamp_seconds 1700000000\n")
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(tempDir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestEscapePrometheusLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapePrometheusLabelValue("a\\b\"c\nd"))
+}
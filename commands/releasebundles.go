@@ -0,0 +1,348 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"github.com/jfrog/jfrog-client-go/utils/errorutils"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	releaseBundleV1 = "v1"
+	releaseBundleV2 = "v2"
+	// Release bundles v1 which are still open can change, so they are never cached.
+	releaseBundleStatusOpen = "OPEN"
+)
+
+// A release bundle version with the artifacts it contains, regardless of the release bundle type.
+type releaseBundle struct {
+	Name      string                  `json:"name"`
+	Version   string                  `json:"version"`
+	Type      string                  `json:"type"`
+	Status    string                  `json:"status"`
+	Created   string                  `json:"created"`
+	Artifacts []releaseBundleArtifact `json:"artifacts"`
+}
+
+type releaseBundleArtifact struct {
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+	// The build which produced the artifact, from its build.name and build.number properties, if any.
+	BuildName   string `json:"buildName,omitempty"`
+	BuildNumber string `json:"buildNumber,omitempty"`
+}
+
+// The response of the Artifactory release bundles v1 API, listing the versions of each release bundle.
+type releaseBundlesV1Response struct {
+	Bundles map[string][]releaseBundleV1Version `json:"bundles"`
+}
+
+type releaseBundleV1Version struct {
+	Version string `json:"version"`
+	Status  string `json:"status"`
+	Created string `json:"created"`
+}
+
+type releaseBundleV1Details struct {
+	Artifacts []releaseBundleV1Artifact `json:"artifacts"`
+}
+
+type releaseBundleV1Artifact struct {
+	Checksum string                  `json:"checksum"`
+	RepoPath string                  `json:"repo_path"`
+	Props    []releaseBundleProperty `json:"props"`
+}
+
+type releaseBundleProperty struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// The responses of the lifecycle release bundles v2 API.
+type releaseBundleV2Records struct {
+	ReleaseBundles []releaseBundleV2Record `json:"release_bundles"`
+}
+
+type releaseBundleV2Record struct {
+	Name    string `json:"release_bundle_name"`
+	Version string `json:"release_bundle_version"`
+	Status  string `json:"status"`
+	Created string `json:"created"`
+}
+
+type releaseBundleV2Details struct {
+	Artifacts []releaseBundleV2Artifact `json:"artifacts"`
+}
+
+type releaseBundleV2Artifact struct {
+	Path       string                  `json:"path"`
+	Sha256     string                  `json:"sha256"`
+	Properties []releaseBundleProperty `json:"properties"`
+}
+
+// Adds the release bundles v1 and v2 to the graph, linked to the binaries they contain and to the builds they were created from.
+// A release bundle type which is not supported by the server, or which can't be read, such as with a token which is not
+// permitted to read it, is skipped.
+func (gb *GraphBuilder) createReleaseBundlesGraphRelations() {
+	bundles := append(gb.getReleaseBundlesV1(), gb.getReleaseBundlesV2()...)
+	log.Info(fmt.Sprintf("Handling %d release bundle versions", len(bundles)))
+	if len(bundles) == 0 {
+		return
+	}
+	binaryBySha256 := gb.getReleaseBundleBinaries(bundles)
+	producedBy := map[*graphNode][]*graphNode{}
+	for _, edge := range gb.graph.edges {
+		if edge.relType == relProduce {
+			producedBy[edge.to] = append(producedBy[edge.to], edge.from)
+		}
+	}
+	for i := range bundles {
+		gb.handleReleaseBundle(&bundles[i], binaryBySha256, producedBy)
+	}
+}
+
+// Creates the release bundle node, linked to the binaries it contains and to the builds in the graph which produced them.
+func (gb *GraphBuilder) handleReleaseBundle(bundle *releaseBundle, binaryBySha256 map[string]*graphNode, producedBy map[*graphNode][]*graphNode) {
+	bundleNode := gb.graphCreateReleaseBundleNode(bundle)
+	for _, artifact := range bundle.Artifacts {
+		if artifact.BuildName != "" && artifact.BuildNumber != "" {
+			if buildNode := gb.graph.getNode(labelBuild, artifact.BuildName, artifact.BuildNumber); buildNode != nil {
+				gb.graph.addEdge(relFromBuild, bundleNode, buildNode, nil)
+			}
+		}
+		binaryNode, ok := binaryBySha256[artifact.Sha256]
+		if !ok {
+			log.Debug(fmt.Sprintf("Release bundle %s/%s contains %s, which was not found", bundle.Name, bundle.Version, artifact.Path))
+			continue
+		}
+		gb.graph.addEdge(relContains, bundleNode, binaryNode, nil)
+		for _, buildNode := range producedBy[binaryNode] {
+			gb.graph.addEdge(relFromBuild, bundleNode, buildNode, nil)
+		}
+	}
+}
+
+func (gb *GraphBuilder) graphCreateReleaseBundleNode(bundle *releaseBundle) *graphNode {
+	properties := map[string]interface{}{"name": bundle.Name, "version": bundle.Version, "type": bundle.Type}
+	if bundle.Status != "" {
+		properties["status"] = bundle.Status
+	}
+	if bundle.Created != "" {
+		properties["created"] = bundle.Created
+	}
+	return gb.graph.addNode(labelReleaseBundle, properties, "name", "version", "type")
+}
+
+// Returns the binaries of the release bundle artifacts, by their sha256 checksums.
+// Binaries which are not in the graph yet are looked up by their sha256 checksums, and linked to their repositories.
+// Failed lookups are logged and skipped.
+func (gb *GraphBuilder) getReleaseBundleBinaries(bundles []releaseBundle) map[string]*graphNode {
+	binaryBySha256 := map[string]*graphNode{}
+	for _, node := range gb.graph.nodes {
+		if sha256, ok := node.properties["sha256"].(string); ok && node.label == labelBinary && sha256 != "" {
+			binaryBySha256[sha256] = node
+		}
+	}
+	var missing []string
+	visited := map[string]bool{}
+	for _, bundle := range bundles {
+		for _, artifact := range bundle.Artifacts {
+			if _, ok := binaryBySha256[artifact.Sha256]; !ok && artifact.Sha256 != "" && !visited[artifact.Sha256] {
+				visited[artifact.Sha256] = true
+				missing = append(missing, artifact.Sha256)
+			}
+		}
+	}
+	for _, batch := range chunkStrings(missing, gb.builderConfig.checksumLookup.batchSize) {
+		results, err := getAqlResults(gb.serviceManager, createAqlQueryForSha256s(batch))
+		if err != nil {
+			log.Error(fmt.Sprintf("Could not find the release bundle artifacts of %d checksums: %s", len(batch), err.Error()))
+			continue
+		}
+		for _, result := range results {
+			binaryNode := gb.graphCreateBinaryNode(result.ActualSha1)
+			if _, ok := binaryNode.properties["name"]; !ok && result.Name != "" {
+				binaryNode.properties["name"] = result.Name
+			}
+			binaryNode.properties["sha256"] = result.Sha256
+			binaryBySha256[result.Sha256] = binaryNode
+			gb.linkBinToRepos(result.ActualSha1, result.Repo)
+		}
+	}
+	return binaryBySha256
+}
+
+func createAqlQueryForSha256s(sha256s []string) string {
+	var criteria []string
+	for _, sha256 := range sha256s {
+		value, _ := json.Marshal(sha256)
+		criteria = append(criteria, fmt.Sprintf(`{"sha256": %s}`, value))
+	}
+	return fmt.Sprintf(`items.find({"$or": [%s]}).include("repo", "path", "name", "actual_sha1", "sha256")`, strings.Join(criteria, ", "))
+}
+
+// Returns the release bundles v1 stored in Artifactory, sorted by name. Versions which can't be read are logged and skipped.
+func (gb *GraphBuilder) getReleaseBundlesV1() []releaseBundle {
+	response := &releaseBundlesV1Response{}
+	found, err := gb.getReleaseBundleJson(gb.baseUrl+"api/release/bundles", response)
+	if err != nil {
+		log.Warn("Could not read the release bundles v1, skipping them: " + err.Error())
+		return nil
+	}
+	if !found {
+		log.Info("Release bundles v1 are not supported by the server, skipping them")
+		return nil
+	}
+	var names []string
+	for name := range response.Bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var bundles []releaseBundle
+	for _, name := range names {
+		for _, version := range response.Bundles[name] {
+			bundle := releaseBundle{Name: name, Version: version.Version, Type: releaseBundleV1, Status: version.Status, Created: version.Created}
+			if !gb.getCachedReleaseBundle(&bundle) {
+				details := &releaseBundleV1Details{}
+				found, err = gb.getReleaseBundleJson(fmt.Sprintf("%sapi/release/bundles/%s/%s", gb.baseUrl, url.PathEscape(name),
+					url.PathEscape(version.Version)), details)
+				if err != nil {
+					log.Error(fmt.Sprintf("Could not read the release bundle %s/%s: %s", name, version.Version, err.Error()))
+					continue
+				}
+				if !found {
+					continue
+				}
+				for _, artifact := range details.Artifacts {
+					bundle.Artifacts = append(bundle.Artifacts, newReleaseBundleArtifact(artifact.RepoPath, artifact.Checksum, artifact.Props))
+				}
+				if !strings.EqualFold(bundle.Status, releaseBundleStatusOpen) {
+					gb.cacheReleaseBundle(&bundle)
+				}
+			}
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+// Returns the release bundles v2 of the lifecycle service, in the selected project if any.
+// Release bundles and versions which can't be read are logged and skipped.
+func (gb *GraphBuilder) getReleaseBundlesV2() []releaseBundle {
+	recordsUrl := gb.lifecycleUrl() + "api/v2/release_bundle/records"
+	projectQuery := gb.builderConfig.buildSelection.projectQuery()
+	names := &releaseBundleV2Records{}
+	found, err := gb.getReleaseBundleJson(gb.lifecycleUrl()+"api/v2/release_bundle/names"+projectQuery, names)
+	if err != nil {
+		log.Warn("Could not read the release bundles v2, skipping them: " + err.Error())
+		return nil
+	}
+	if !found {
+		log.Info("Release bundles v2 are not supported by the server, skipping them")
+		return nil
+	}
+	var bundles []releaseBundle
+	for _, name := range names.ReleaseBundles {
+		versions := &releaseBundleV2Records{}
+		if _, err = gb.getReleaseBundleJson(fmt.Sprintf("%s/%s%s", recordsUrl, url.PathEscape(name.Name), projectQuery), versions); err != nil {
+			log.Error(fmt.Sprintf("Could not read the versions of the release bundle %s: %s", name.Name, err.Error()))
+			continue
+		}
+		for _, version := range versions.ReleaseBundles {
+			bundle := releaseBundle{Name: name.Name, Version: version.Version, Type: releaseBundleV2, Status: version.Status, Created: version.Created}
+			if !gb.getCachedReleaseBundle(&bundle) {
+				details := &releaseBundleV2Details{}
+				found, err = gb.getReleaseBundleJson(fmt.Sprintf("%s/%s/%s%s", recordsUrl, url.PathEscape(name.Name),
+					url.PathEscape(version.Version), projectQuery), details)
+				if err != nil {
+					log.Error(fmt.Sprintf("Could not read the release bundle %s/%s: %s", name.Name, version.Version, err.Error()))
+					continue
+				}
+				if !found {
+					continue
+				}
+				for _, artifact := range details.Artifacts {
+					bundle.Artifacts = append(bundle.Artifacts, newReleaseBundleArtifact(artifact.Path, artifact.Sha256, artifact.Properties))
+				}
+				gb.cacheReleaseBundle(&bundle)
+			}
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+func newReleaseBundleArtifact(path, sha256 string, properties []releaseBundleProperty) releaseBundleArtifact {
+	artifact := releaseBundleArtifact{Path: path, Sha256: sha256}
+	for _, property := range properties {
+		if len(property.Values) == 0 {
+			continue
+		}
+		switch property.Key {
+		case "build.name":
+			artifact.BuildName = property.Values[0]
+		case "build.number":
+			artifact.BuildNumber = property.Values[0]
+		}
+	}
+	return artifact
+}
+
+// Returns the URL of the lifecycle service, which is served by the platform next to Artifactory.
+func (gb *GraphBuilder) lifecycleUrl() string {
+	if gb.rtDetails.Url != "" {
+		return clientutils.AddTrailingSlashIfNeeded(gb.rtDetails.Url) + "lifecycle/"
+	}
+	return strings.TrimSuffix(gb.baseUrl, "artifactory/") + "lifecycle/"
+}
+
+// Reads the cached artifacts of the release bundle version, if any.
+// The cache key includes the status, so that the artifacts are fetched again once the status changes.
+func (gb *GraphBuilder) getCachedReleaseBundle(bundle *releaseBundle) bool {
+	cached := &releaseBundle{}
+	if !gb.cache.get(cacheReleaseBundles, releaseBundleCacheKey(bundle), 0, cached) {
+		return false
+	}
+	bundle.Artifacts = cached.Artifacts
+	return true
+}
+
+func (gb *GraphBuilder) cacheReleaseBundle(bundle *releaseBundle) {
+	gb.cache.put(cacheReleaseBundles, releaseBundleCacheKey(bundle), bundle)
+}
+
+func releaseBundleCacheKey(bundle *releaseBundle) string {
+	return strings.Join([]string{bundle.Type, bundle.Name, bundle.Version, bundle.Status}, "\x00")
+}
+
+// Reads the JSON response of the URL into the value. Returns false if the URL was not found.
+func (gb *GraphBuilder) getReleaseBundleJson(requestUrl string, value interface{}) (bool, error) {
+	resp, respBody, _, err := gb.serviceManager.Client().SendGet(requestUrl, true, &gb.clientDetails)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err = errorutils.CheckResponseStatus(resp, http.StatusOK); err != nil {
+		return false, errorutils.GenerateResponseError(resp.Status, clientutils.IndentJson(respBody))
+	}
+	return true, json.Unmarshal(respBody, value)
+}
+
+func getReleaseBundleFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name: "release-bundles",
+			Description: "[Default: false] Set to true to add the release bundles v1 and v2 to the graph, " +
+				"linked to the binaries they contain and to the builds they were created from.",
+			DefaultValue: false,
+		},
+	}
+}
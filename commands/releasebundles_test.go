@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestCreateReleaseBundlesGraphRelations(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{
+		"/api/release/bundles": `{"bundles": {"bundle1": [{"version": "1.0", "status": "SIGNED", "created": "2021-03-01T10:00:00.000Z"}]}}`,
+		"/api/release/bundles/bundle1/1.0": `{"artifacts": [{"checksum": "sha256-1", "repo_path": "local1/app.tgz"},
+			{"checksum": "sha256-2", "repo_path": "local1/lib.tgz", "props": [{"key": "build.name", "values": ["lib"]}, {"key": "build.number", "values": ["7"]}]},
+			{"checksum": "sha256-3", "repo_path": "local1/missing.tgz"}]}`,
+		"/api/search/aql":                                      `{"results": [{"repo": "local1", "path": ".", "name": "lib.tgz", "actual_sha1": "sha2", "sha256": "sha256-2"}]}`,
+		"/lifecycle/api/v2/release_bundle/names":               `{"release_bundles": [{"release_bundle_name": "bundle2"}]}`,
+		"/lifecycle/api/v2/release_bundle/records/bundle2":     `{"release_bundles": [{"release_bundle_name": "bundle2", "release_bundle_version": "2.0", "status": "COMPLETED"}]}`,
+		"/lifecycle/api/v2/release_bundle/records/bundle2/2.0": `{"artifacts": [{"path": "local1/app.tgz", "sha256": "sha256-1"}]}`,
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.graphCreateRelationshipBuildToArtifact("app", "1", "sha1")
+	gb.graph.getNode(labelBinary, "sha1").properties["sha256"] = "sha256-1"
+	gb.graphCreateBuildNode("lib", "7")
+
+	gb.createReleaseBundlesGraphRelations()
+	app := gb.graph.getNode(labelBuild, "app", "1")
+	lib := gb.graph.getNode(labelBuild, "lib", "7")
+	bundle1 := gb.graph.getNode(labelReleaseBundle, "bundle1", "1.0", releaseBundleV1)
+	bundle2 := gb.graph.getNode(labelReleaseBundle, "bundle2", "2.0", releaseBundleV2)
+	if assert.NotNil(t, bundle1) && assert.NotNil(t, bundle2) {
+		assert.Equal(t, releaseBundleV1, bundle1.properties["type"])
+		assert.Equal(t, "SIGNED", bundle1.properties["status"])
+		assert.Equal(t, releaseBundleV2, bundle2.properties["type"])
+		assert.Contains(t, gb.graph.edgeById, edgeId(relContains, bundle1, gb.graph.getNode(labelBinary, "sha2")))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relFromBuild, bundle1, app))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relFromBuild, bundle1, lib))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relFromBuild, bundle2, app))
+	}
+	assert.Equal(t, "sha256-2", gb.graph.getNode(labelBinary, "sha2").properties["sha256"])
+	assert.Equal(t, map[string]int{relProduce: 1, relContains: 3, relFromBuild: 3}, gb.graph.edgeCounts())
+}
+
+func TestCreateReleaseBundlesGraphRelationsUnsupported(t *testing.T) {
+	gb := newTestGraphBuilder(t, map[string]string{}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.createReleaseBundlesGraphRelations()
+	assert.Empty(t, gb.graph.nodeCounts()[labelReleaseBundle])
+}
+
+func TestCreateReleaseBundlesGraphRelationsForbidden(t *testing.T) {
+	gb := newTestGraphBuilderWithHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/release/bundles":
+			w.WriteHeader(http.StatusForbidden)
+		case "/lifecycle/api/v2/release_bundle/names":
+			_, _ = w.Write([]byte(`{"release_bundles": [{"release_bundle_name": "bundle1"}, {"release_bundle_name": "bundle2"}]}`))
+		case "/lifecycle/api/v2/release_bundle/records/bundle1":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/lifecycle/api/v2/release_bundle/records/bundle2":
+			_, _ = w.Write([]byte(`{"release_bundles": [{"release_bundle_name": "bundle2", "release_bundle_version": "2.0"}]}`))
+		case "/lifecycle/api/v2/release_bundle/records/bundle2/2.0":
+			_, _ = w.Write([]byte(`{"artifacts": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, &graphBuilderConfig{buildSelection: &buildSelection{}, checksumLookup: testChecksumLookup})
+	gb.createReleaseBundlesGraphRelations()
+	assert.Equal(t, 1, gb.graph.nodeCounts()[labelReleaseBundle])
+	assert.NotNil(t, gb.graph.getNode(labelReleaseBundle, "bundle2", "2.0", releaseBundleV2))
+}
+
+func TestNewReleaseBundleArtifact(t *testing.T) {
+	artifact := newReleaseBundleArtifact("repo/path", "sha256", []releaseBundleProperty{
+		{Key: "build.name", Values: []string{"app"}}, {Key: "build.number", Values: []string{"3"}}, {Key: "build.timestamp"}})
+	assert.Equal(t, releaseBundleArtifact{Path: "repo/path", Sha256: "sha256", BuildName: "app", BuildNumber: "3"}, artifact)
+}
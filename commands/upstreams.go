@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Trust levels of the upstreams of remote repositories. Only untrusted upstreams are exposed to the attacker.
+const (
+	// Our own instances, such as the targets of smart remote repositories.
+	trustInternal = "internal"
+	// External registries which were vetted, such as mirrors of a partner.
+	trustTrusted   = "trusted"
+	trustUntrusted = "untrusted"
+)
+
+// Decides the trust level of the upstream hosts.
+type upstreamTrust struct {
+	internal []*regexp.Regexp
+	trusted  []*regexp.Regexp
+}
+
+func getUpstreamTrust(c *components.Context) (*upstreamTrust, error) {
+	return newUpstreamTrust(c.GetStringFlagValue("internal-upstreams"), c.GetStringFlagValue("trusted-upstreams"))
+}
+
+func newUpstreamTrust(internalUpstreams, trustedUpstreams string) (*upstreamTrust, error) {
+	internal, err := wildcardsToRegExps(splitFlagList(strings.ToLower(internalUpstreams)))
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := wildcardsToRegExps(splitFlagList(strings.ToLower(trustedUpstreams)))
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamTrust{internal: internal, trusted: trusted}, nil
+}
+
+// Returns the trust level of the upstream host. The host of the server itself is internal.
+// A nil trust considers all the other hosts untrusted.
+func (ut *upstreamTrust) level(host, serverHost string) string {
+	if host == serverHost {
+		return trustInternal
+	}
+	if ut == nil {
+		return trustUntrusted
+	}
+	if matchesAny(ut.internal, host) {
+		return trustInternal
+	}
+	if matchesAny(ut.trusted, host) {
+		return trustTrusted
+	}
+	return trustUntrusted
+}
+
+// Returns the lowercase host of the URL, or an empty string if it has none.
+func urlHost(rawUrl string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// Links the remote repository to the upstream of its URL, which the attacker attacks only if it is untrusted.
+// The attacker attacks a remote repository without a known upstream directly.
+func (gb *GraphBuilder) linkRemoteToUpstream(repoNode *graphNode, remoteUrl string) {
+	host := urlHost(remoteUrl)
+	if host == "" {
+		gb.graph.addEdge(relAttacks, gb.graphCreateAttackerNode(), repoNode, nil)
+		return
+	}
+	upstreamNode := gb.graphCreateUpstreamNode(host, gb.builderConfig.upstreamTrust.level(host, urlHost(gb.baseUrl)))
+	gb.graph.addEdge(relUpstreamOf, upstreamNode, repoNode, nil)
+	if upstreamNode.properties["trust"] == trustUntrusted {
+		gb.graph.addEdge(relAttacks, gb.graphCreateAttackerNode(), upstreamNode, nil)
+	}
+}
+
+func (gb *GraphBuilder) graphCreateUpstreamNode(host, trust string) *graphNode {
+	return gb.graph.addNode(labelUpstream, map[string]interface{}{"host": host, "trust": trust}, "host")
+}
+
+func getUpstreamTrustFlags() []components.Flag {
+	return []components.Flag{
+		components.StringFlag{
+			Name: "internal-upstreams",
+			Description: "Comma-separated list of wildcard patterns of the upstream hosts of remote repositories which are our own instances, " +
+				"such as the targets of smart remote repositories. The host of the server is always internal.",
+		},
+		components.StringFlag{
+			Name: "trusted-upstreams",
+			Description: "Comma-separated list of wildcard patterns of the upstream hosts of remote repositories which are trusted. " +
+				"Only the remote repositories of untrusted upstreams are exposed to the attacker.",
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpstreamTrustLevel(t *testing.T) {
+	trust, err := newUpstreamTrust("*.acme.internal", "repo1.maven.org,*.Partner.com")
+	assert.NoError(t, err)
+	assert.Equal(t, trustInternal, trust.level("artifactory.acme.internal", "acme.jfrog.io"))
+	assert.Equal(t, trustInternal, trust.level("acme.jfrog.io", "acme.jfrog.io"))
+	assert.Equal(t, trustTrusted, trust.level("repo1.maven.org", "acme.jfrog.io"))
+	assert.Equal(t, trustTrusted, trust.level("mirror.partner.com", "acme.jfrog.io"))
+	assert.Equal(t, trustUntrusted, trust.level("registry.npmjs.org", "acme.jfrog.io"))
+	assert.Equal(t, trustUntrusted, (*upstreamTrust)(nil).level("registry.npmjs.org", "acme.jfrog.io"))
+}
+
+func TestUrlHost(t *testing.T) {
+	assert.Equal(t, "registry.npmjs.org", urlHost("https://Registry.npmjs.org/"))
+	assert.Equal(t, "mirror.acme.internal", urlHost(" http://mirror.acme.internal:8081/artifactory/api/npm/npm "))
+	assert.Empty(t, urlHost(""))
+	assert.Empty(t, urlHost("not a url"))
+}
+
+func TestLinkRemoteToUpstream(t *testing.T) {
+	trust, err := newUpstreamTrust("", "repo1.maven.org")
+	assert.NoError(t, err)
+	gb := newTestGraphBuilder(t, map[string]string{}, &graphBuilderConfig{upstreamTrust: trust})
+	gb.graphCreateRemoteRepoNode("npm-remote", "https://registry.npmjs.org", false, false, false, false)
+	gb.graphCreateRemoteRepoNode("npm-remote2", "https://registry.npmjs.org/", false, false, false, false)
+	gb.graphCreateRemoteRepoNode("maven-remote", "https://repo1.maven.org/maven2", false, false, false, false)
+	gb.graphCreateRemoteRepoNode("smart-remote", gb.baseUrl+"api/npm/npm", false, false, false, false)
+	gb.graphCreateRemoteRepoNode("unknown-remote", "", false, false, false, false)
+
+	attacker := gb.graph.getNode(labelAttacker, "attacker")
+	npmjs := gb.graph.getNode(labelUpstream, "registry.npmjs.org")
+	maven := gb.graph.getNode(labelUpstream, "repo1.maven.org")
+	if assert.NotNil(t, npmjs) && assert.NotNil(t, maven) {
+		assert.Equal(t, trustUntrusted, npmjs.properties["trust"])
+		assert.Equal(t, trustTrusted, maven.properties["trust"])
+		assert.Contains(t, gb.graph.edgeById, edgeId(relAttacks, attacker, npmjs))
+		assert.NotContains(t, gb.graph.edgeById, edgeId(relAttacks, attacker, maven))
+		assert.Contains(t, gb.graph.edgeById, edgeId(relUpstreamOf, npmjs, gb.graph.getNode(labelRepoRemote, "npm-remote2")))
+	}
+	assert.Equal(t, trustInternal, gb.graph.getNode(labelUpstream, urlHost(gb.baseUrl)).properties["trust"])
+	assert.Contains(t, gb.graph.edgeById, edgeId(relAttacks, attacker, gb.graph.getNode(labelRepoRemote, "unknown-remote")))
+	assert.Equal(t, map[string]int{relAttacks: 2, relUpstreamOf: 4}, gb.graph.edgeCounts())
+
+	gb.graphCreateRelationshipBinaryToRepo("sha1", "npm-remote")
+	gb.graphCreateRelationshipDependencyToBuild("app", "1", "sha1")
+	gb.graphCreateRelationshipBinaryToRepo("sha2", "maven-remote")
+	gb.graphCreateRelationshipDependencyToBuild("lib", "1", "sha2")
+	paths := findAttackPaths(gb.graph, false)
+	if assert.Len(t, paths, 1) {
+		assert.Equal(t, "attacker -[ATTACKS]-> registry.npmjs.org -[UPSTREAM_OF]-> npm-remote -[STORES]-> sha1 -[DEPENDENCY_FOR]-> app/1", paths[0].String())
+	}
+}
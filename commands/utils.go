@@ -2,10 +2,13 @@ package commands
 
 import (
 	"errors"
+	"fmt"
 	"github.com/jfrog/jfrog-cli-core/v2/common/commands"
 	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
 	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
 	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"io"
+	"reflect"
 	"strings"
 )
 
@@ -30,11 +33,13 @@ func getRtDetails(c *components.Context) (*config.ServerDetails, error) {
 type CommonRepositoryDetails struct {
 	Key                string `json:"key"`
 	Rclass             string `json:"rclass"`
+	Url                string `json:"url"`
 	XrayIndex          bool   `json:"xrayIndex"`
 	PackageType        string `json:"packageType"`
 	IncludesPattern    string `json:"includesPattern"`
 	ExcludesPattern    string `json:"excludesPattern"`
 	PriorityResolution bool   `json:"priorityResolution"`
+	ProjectKey         string `json:"projectKey"`
 	IsSafe             bool
 }
 
@@ -44,13 +49,17 @@ type VirtualRepositoryDetails struct {
 }
 
 func checkVirtualRepoSafety(repositoryConfig *VirtualRepositoryDetails, localRemoteReposConfig map[string]*CommonRepositoryDetails) bool {
-	repoIsSafe := true
+	return len(getVirtualRepoRisks(repositoryConfig, localRemoteReposConfig)) == 0
+}
+
+// Returns the reasons for which the virtual repository is considered at risk, or nothing if it is safe.
+func getVirtualRepoRisks(repositoryConfig *VirtualRepositoryDetails, localRemoteReposConfig map[string]*CommonRepositoryDetails) []string {
+	var risks []string
 	localWithPriorityExists := false
 	for _, repo := range repositoryConfig.Repositories {
 		if config, ok := localRemoteReposConfig[repo]; ok {
 			if !config.XrayIndex {
-				repoIsSafe = false
-				break
+				risks = append(risks, fmt.Sprintf("Member repository '%s' is not indexed by Xray.", repo))
 			}
 			if strings.EqualFold(config.Rclass, "local") {
 				if config.PriorityResolution {
@@ -58,11 +67,43 @@ func checkVirtualRepoSafety(repositoryConfig *VirtualRepositoryDetails, localRem
 				}
 			} else if strings.EqualFold(config.Rclass, "remote") {
 				if config.IncludesPattern == "**/*" && config.ExcludesPattern == "" {
-					repoIsSafe = false
-					break
+					risks = append(risks, fmt.Sprintf("Member remote repository '%s' has no include or exclude patterns configured.", repo))
 				}
 			}
 		}
 	}
-	return repoIsSafe && localWithPriorityExists
+	if !localWithPriorityExists {
+		risks = append(risks, "No member local repository has priority resolution enabled.")
+	}
+	return risks
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Closes the closer, and returns the close error combined with the previous error, if any.
+func closeWithError(closer io.Closer, previousError error) error {
+	err := closer.Close()
+	if err == nil {
+		return previousError
+	}
+	if previousError == nil {
+		return err
+	}
+	return fmt.Errorf("%v closure error occurred:\n%s\ninitial error was:\n%w", reflect.TypeOf(closer), err.Error(), previousError)
+}
+
+// Returns the flags of all the groups, in order.
+func joinFlagGroups(groups [][]components.Flag) []components.Flag {
+	var flags []components.Flag
+	for _, group := range groups {
+		flags = append(flags, group...)
+	}
+	return flags
 }
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func GetWatchCommand() components.Command {
+	return components.Command{
+		Name:        "watch",
+		Description: "Periodically audit Artifactory repositories and report changes in the findings.",
+		Aliases:     []string{"w"},
+		Arguments:   getWatchArguments(),
+		Flags:       getWatchFlags(),
+		Action: func(c *components.Context) error {
+			return watchCmd(c)
+		},
+	}
+}
+
+func watchCmd(c *components.Context) error {
+	if len(c.Arguments) != 0 {
+		return errors.New(fmt.Sprintf("Wrong number of arguments. Expected: 0, Received: %d", len(c.Arguments)))
+	}
+	rtDetails, err := getRtDetails(c)
+	if err != nil {
+		return err
+	}
+	config, err := getWatchConfig(c)
+	if err != nil {
+		return err
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	return doWatch(rtDetails, config, stop)
+}
+
+type watchConfig struct {
+	interval   time.Duration
+	stateFile  string
+	outputFile string
+	notifier   *notifier
+	repoFilter *repoFilter
+}
+
+func getWatchConfig(c *components.Context) (*watchConfig, error) {
+	filter, err := getRepoFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := time.ParseDuration(c.GetStringFlagValue("interval"))
+	if err != nil {
+		return nil, errors.New("invalid interval: " + err.Error())
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	notifier, err := getNotifier(c)
+	if err != nil {
+		return nil, err
+	}
+	return &watchConfig{
+		interval:   interval,
+		stateFile:  c.GetStringFlagValue("state-file"),
+		outputFile: c.GetStringFlagValue("output-file"),
+		notifier:   notifier,
+		repoFilter: filter,
+	}, nil
+}
+
+func doWatch(artifactoryDetails *config.ServerDetails, watchConfig *watchConfig, stop <-chan os.Signal) error {
+	// The previous findings are kept in memory, and also on disk if a state file is configured.
+	var previous []finding
+	if watchConfig.stateFile != "" {
+		state, err := loadFindingsState(watchConfig.stateFile)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			previous = state.Findings
+		}
+	}
+	log.Info(fmt.Sprintf("Watching repositories, auditing every %s. Press Ctrl+C to stop.", watchConfig.interval))
+	for {
+		current, err := watchIteration(artifactoryDetails, watchConfig, previous)
+		if err != nil {
+			// A failed run shouldn't stop the watch, the next run may succeed.
+			log.Error("Audit run failed: " + err.Error())
+		} else {
+			previous = current
+		}
+		select {
+		case sig := <-stop:
+			log.Info(fmt.Sprintf("Received %s, stopping watch.", sig))
+			return nil
+		case <-time.After(watchConfig.interval):
+		}
+	}
+}
+
+// Runs a single audit, emits the change from the previous findings if there is one, and returns the current findings.
+func watchIteration(artifactoryDetails *config.ServerDetails, watchConfig *watchConfig, previous []finding) ([]finding, error) {
+	results, err := collectAuditResults(artifactoryDetails, watchConfig.repoFilter)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	current := getFindings(results)
+	diff := diffFindings(previous, current)
+	if diff.isEmpty() {
+		log.Debug("No change in findings.")
+	} else {
+		err = emitFindingsChange(watchConfig, &findingsChange{Source: "audit", Timestamp: now, TotalFindings: len(current), findingsDiff: diff})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if watchConfig.stateFile != "" {
+		err = saveFindingsState(watchConfig.stateFile, &findingsState{Timestamp: now, Findings: current})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func emitFindingsChange(watchConfig *watchConfig, change *findingsChange) error {
+	logFindingsChange(change)
+	if watchConfig.outputFile != "" {
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		err = appendLine(watchConfig.outputFile, payload)
+		if err != nil {
+			return errors.New("Failed writing findings change to file: " + err.Error())
+		}
+	}
+	if watchConfig.notifier != nil {
+		return watchConfig.notifier.notify(change)
+	}
+	return nil
+}
+
+func appendLine(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func getWatchArguments() []components.Argument {
+	return []components.Argument{}
+}
+
+func getWatchFlags() []components.Flag {
+	return append([]components.Flag{
+		components.StringFlag{
+			Name:        "server-id",
+			Description: "Artifactory server ID configured using the config command.",
+		},
+		components.StringFlag{
+			Name:         "interval",
+			Description:  "[Default: 1h] Time to wait between audit runs, e.g. 30m or 2h.",
+			DefaultValue: "1h",
+		},
+		getStateFileFlag(),
+		components.StringFlag{
+			Name:        "output-file",
+			Description: "Path to a file to append findings changes to, as JSON lines.",
+		},
+	}, append(getNotifierFlags(), getRepoFilterFlags()...)...)
+}
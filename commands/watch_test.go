@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmitFindingsChange(t *testing.T) {
+	var received []findingsChange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		change := findingsChange{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&change))
+		received = append(received, change)
+	}))
+	defer server.Close()
+	tempDir, err := ioutil.TempDir("", "stechhelm-watch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	outputFile := filepath.Join(tempDir, "changes.jsonl")
+
+	watchConfig := &watchConfig{outputFile: outputFile, notifier: newTestNotifier(server.URL)}
+	change := &findingsChange{
+		Source:        "audit",
+		Timestamp:     time.Unix(1700000000, 0).UTC(),
+		TotalFindings: 1,
+		findingsDiff: findingsDiff{
+			New:      []finding{{Repo: "local1", Rclass: "local", Rule: ruleXrayIndex, Reason: "Not indexed."}},
+			Resolved: []finding{},
+		},
+	}
+	assert.NoError(t, emitFindingsChange(watchConfig, change))
+	assert.NoError(t, emitFindingsChange(watchConfig, change))
+
+	assert.Equal(t, []findingsChange{*change, *change}, received)
+	content, err := ioutil.ReadFile(outputFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"new":[{"repo":"local1"`)
+}
+
+func TestEmitFindingsChangeWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	err := emitFindingsChange(&watchConfig{notifier: newTestNotifier(server.URL)}, &findingsChange{findingsDiff: findingsDiff{New: []finding{{Repo: "r"}}}})
+	assert.Error(t, err)
+}
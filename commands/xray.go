@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+	xraycommands "github.com/jfrog/jfrog-cli-core/v2/xray/commands"
+	"github.com/jfrog/jfrog-client-go/http/jfroghttpclient"
+	clientutils "github.com/jfrog/jfrog-client-go/utils"
+	"github.com/jfrog/jfrog-client-go/utils/errorutils"
+	"github.com/jfrog/jfrog-client-go/utils/io/httputils"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Number of binaries summarized in a single Xray request.
+const xraySummaryBatchSize = 100
+
+// Severities of Xray issues, from the lowest to the highest.
+var xraySeverities = []string{"Unknown", "Information", "Low", "Medium", "High", "Critical"}
+
+// Provides the Xray summaries of binaries, by their sha256 checksums.
+// Implemented by Xray, and by a local file standing in for it.
+type summaryProvider interface {
+	getArtifactSummaries(sha256s []string) ([]xrayArtifactSummary, error)
+}
+
+// The response of the Xray artifact summary API. It is also the format of the local summaries file.
+type xraySummaryResponse struct {
+	Artifacts []xrayArtifactSummary `json:"artifacts"`
+	Errors    []xraySummaryError    `json:"errors,omitempty"`
+}
+
+type xrayArtifactSummary struct {
+	General  xrayArtifactGeneral `json:"general"`
+	Issues   []xrayIssue         `json:"issues"`
+	Licenses []xrayLicense       `json:"licenses"`
+}
+
+type xrayArtifactGeneral struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	PkgType     string `json:"pkg_type"`
+	Sha256      string `json:"sha256"`
+	ComponentId string `json:"component_id"`
+}
+
+type xrayIssue struct {
+	IssueId   string    `json:"issue_id"`
+	Summary   string    `json:"summary"`
+	IssueType string    `json:"issue_type"`
+	Severity  string    `json:"severity"`
+	Provider  string    `json:"provider"`
+	Cves      []xrayCve `json:"cves"`
+}
+
+type xrayCve struct {
+	Cve    string `json:"cve"`
+	CvssV2 string `json:"cvss_v2"`
+	CvssV3 string `json:"cvss_v3"`
+}
+
+type xrayLicense struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+type xraySummaryError struct {
+	Identifier string `json:"identifier"`
+	Error      string `json:"error"`
+}
+
+// Returns the provider of the Xray summaries, or nil if the binaries shouldn't be enriched with Xray data.
+func newSummaryProvider(builderConfig *graphBuilderConfig, rtDetails *config.ServerDetails) (summaryProvider, error) {
+	if builderConfig.xraySummariesFile != "" {
+		return newFileSummaryProvider(builderConfig.xraySummariesFile)
+	}
+	if builderConfig.xray {
+		return newXrayClient(rtDetails)
+	}
+	return nil, nil
+}
+
+type xrayClient struct {
+	client        *jfroghttpclient.JfrogHttpClient
+	url           string
+	clientDetails httputils.HttpClientDetails
+}
+
+func newXrayClient(rtDetails *config.ServerDetails) (*xrayClient, error) {
+	if rtDetails.XrayUrl == "" {
+		return nil, errors.New("the server has no Xray URL configured")
+	}
+	serviceManager, err := xraycommands.CreateXrayServiceManager(rtDetails)
+	if err != nil {
+		return nil, err
+	}
+	serviceDetails := serviceManager.Config().GetServiceDetails()
+	return &xrayClient{
+		client:        serviceManager.Client(),
+		url:           clientutils.AddTrailingSlashIfNeeded(serviceDetails.GetUrl()),
+		clientDetails: serviceDetails.CreateHttpClientDetails(),
+	}, nil
+}
+
+func (xc *xrayClient) getArtifactSummaries(sha256s []string) ([]xrayArtifactSummary, error) {
+	content, err := json.Marshal(map[string][]string{"checksums": sha256s})
+	if err != nil {
+		return nil, err
+	}
+	clientDetails := xc.clientDetails.Clone()
+	clientDetails.Headers["Content-Type"] = "application/json"
+	resp, respBody, err := xc.client.SendPost(xc.url+"api/v1/summary/artifact", content, clientDetails)
+	if err != nil {
+		return nil, err
+	}
+	if err = errorutils.CheckResponseStatus(resp, http.StatusOK); err != nil {
+		return nil, errorutils.GenerateResponseError(resp.Status, clientutils.IndentJson(respBody))
+	}
+	response := &xraySummaryResponse{}
+	if err = json.Unmarshal(respBody, response); err != nil {
+		return nil, err
+	}
+	for _, summaryError := range response.Errors {
+		log.Debug(fmt.Sprintf("No Xray summary for %s: %s", summaryError.Identifier, summaryError.Error))
+	}
+	return response.Artifacts, nil
+}
+
+// Provides the summaries stored in a file, in the format of the Xray artifact summary API response.
+type fileSummaryProvider struct {
+	summaryBySha256 map[string]xrayArtifactSummary
+}
+
+func newFileSummaryProvider(path string) (*fileSummaryProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	response := &xraySummaryResponse{}
+	if err = json.Unmarshal(content, response); err != nil {
+		return nil, errors.New("Failed parsing Xray summaries file " + path + ": " + err.Error())
+	}
+	provider := &fileSummaryProvider{summaryBySha256: map[string]xrayArtifactSummary{}}
+	for _, summary := range response.Artifacts {
+		provider.summaryBySha256[summary.General.Sha256] = summary
+	}
+	return provider, nil
+}
+
+func (fp *fileSummaryProvider) getArtifactSummaries(sha256s []string) ([]xrayArtifactSummary, error) {
+	var summaries []xrayArtifactSummary
+	for _, sha256 := range sha256s {
+		if summary, ok := fp.summaryBySha256[sha256]; ok {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries, nil
+}
+
+// Enriches the binaries with their Xray summaries, and links them to their vulnerabilities.
+// Only binaries found in a repository have a sha256 checksum, and can be summarized.
+// Failed batches are logged and skipped.
+func (gb *GraphBuilder) addXraySummaries() error {
+	binaryBySha256 := map[string]*graphNode{}
+	var sha256s []string
+	for _, node := range gb.graph.nodes {
+		if sha256, ok := node.properties["sha256"].(string); ok && node.label == labelBinary && sha256 != "" {
+			if _, exists := binaryBySha256[sha256]; !exists {
+				sha256s = append(sha256s, sha256)
+			}
+			binaryBySha256[sha256] = node
+		}
+	}
+	summarized := 0
+	for _, batch := range chunkStrings(sha256s, xraySummaryBatchSize) {
+		summaries, err := gb.summaryProvider.getArtifactSummaries(batch)
+		if err != nil {
+			log.Error(fmt.Sprintf("Could not get the Xray summaries of %d binaries: %s", len(batch), err.Error()))
+			continue
+		}
+		for i := range summaries {
+			if binaryNode, ok := binaryBySha256[summaries[i].General.Sha256]; ok {
+				gb.addArtifactSummary(binaryNode, &summaries[i])
+				summarized++
+			}
+		}
+	}
+	log.Info(fmt.Sprintf("Found the Xray summaries of %d/%d binaries", summarized, len(sha256s)))
+	return nil
+}
+
+// Sets the component, licenses, CVEs and highest severity of the binary, and links it to its security issues.
+func (gb *GraphBuilder) addArtifactSummary(binaryNode *graphNode, summary *xrayArtifactSummary) {
+	if summary.General.ComponentId != "" {
+		binaryNode.properties["component_id"] = summary.General.ComponentId
+	}
+	var licenses []string
+	for _, license := range summary.Licenses {
+		licenses = appendUnique(licenses, license.Name)
+	}
+	var cves []string
+	maxSeverity := ""
+	for i := range summary.Issues {
+		issue := &summary.Issues[i]
+		if !strings.EqualFold(issue.IssueType, "security") {
+			continue
+		}
+		vulnerabilityNode := gb.graphCreateVulnerabilityNode(issue)
+		gb.graph.addEdge(relAffectedBy, binaryNode, vulnerabilityNode, nil)
+		for _, cve := range issue.Cves {
+			if cve.Cve != "" {
+				cves = appendUnique(cves, cve.Cve)
+			}
+		}
+		if severityRank(issue.Severity) > severityRank(maxSeverity) {
+			maxSeverity = issue.Severity
+		}
+	}
+	if len(licenses) > 0 {
+		sort.Strings(licenses)
+		binaryNode.properties["licenses"] = licenses
+	}
+	if len(cves) > 0 {
+		sort.Strings(cves)
+		binaryNode.properties["cves"] = cves
+	}
+	if maxSeverity != "" {
+		binaryNode.properties["max_severity"] = maxSeverity
+	}
+}
+
+func (gb *GraphBuilder) graphCreateVulnerabilityNode(issue *xrayIssue) *graphNode {
+	properties := map[string]interface{}{"id": issue.IssueId, "severity": issue.Severity, "summary": issue.Summary}
+	var cves []string
+	for _, cve := range issue.Cves {
+		if cve.Cve != "" {
+			cves = appendUnique(cves, cve.Cve)
+		}
+	}
+	if len(cves) > 0 {
+		properties["cves"] = cves
+	}
+	return gb.graph.addNode(labelVulnerability, properties, "id")
+}
+
+// Returns the rank of the severity, from 0 for an unknown severity to 5 for a critical one.
+func severityRank(severity string) int {
+	for i := len(xraySeverities) - 1; i >= 0; i-- {
+		if strings.EqualFold(xraySeverities[i], severity) {
+			return i
+		}
+	}
+	return 0
+}
+
+func appendUnique(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func getXrayFlags() []components.Flag {
+	return []components.Flag{
+		components.BoolFlag{
+			Name:         "xray",
+			Description:  "[Default: false] Set to true to add the Xray vulnerabilities and licenses of the binaries to the graph.",
+			DefaultValue: false,
+		},
+		components.StringFlag{
+			Name: "xray-summaries-file",
+			Description: "Path to a file with the Xray summaries of the binaries, in the format of the Xray artifact summary API response. " +
+				"Implies xray, and is used instead of Xray.",
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const testXraySummaries = `{"artifacts": [{
+	"general": {"name": "lodash-4.17.15.tgz", "pkg_type": "Npm", "sha256": "sha256-1", "component_id": "npm://lodash:4.17.15"},
+	"issues": [
+		{"issue_id": "XRAY-1", "summary": "Prototype pollution", "issue_type": "security", "severity": "High", "cves": [{"cve": "CVE-2020-8203"}]},
+		{"issue_id": "XRAY-2", "summary": "Command injection", "issue_type": "security", "severity": "Critical", "cves": [{"cve": "CVE-2021-23337"}]},
+		{"issue_id": "XRAY-3", "summary": "Outdated", "issue_type": "operational_risk", "severity": "Low"}],
+	"licenses": [{"name": "MIT"}, {"name": "MIT"}]}]}`
+
+// Stands in for Xray, with the summaries of the binaries by their sha256 checksums.
+type testSummaryProvider map[string]xrayArtifactSummary
+
+func (tp testSummaryProvider) getArtifactSummaries(sha256s []string) ([]xrayArtifactSummary, error) {
+	var summaries []xrayArtifactSummary
+	for _, sha256 := range sha256s {
+		if summary, ok := tp[sha256]; ok {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries, nil
+}
+
+func TestAddXraySummaries(t *testing.T) {
+	gb := &GraphBuilder{graph: newGraphModel(), summaryProvider: testSummaryProvider{
+		"sha256-1": {General: xrayArtifactGeneral{Sha256: "sha256-1", ComponentId: "npm://lodash:4.17.15"},
+			Issues: []xrayIssue{
+				{IssueId: "XRAY-1", IssueType: "security", Severity: "High", Cves: []xrayCve{{Cve: "CVE-2020-8203"}}},
+				{IssueId: "XRAY-2", IssueType: "security", Severity: "Critical", Cves: []xrayCve{{Cve: "CVE-2021-23337"}}},
+				{IssueId: "XRAY-3", IssueType: "license", Severity: "Medium"},
+			},
+			Licenses: []xrayLicense{{Name: "MIT"}, {Name: "Apache-2.0"}},
+		},
+	}}
+	binary := gb.graphCreateBinaryNode("sha1")
+	binary.properties["sha256"] = "sha256-1"
+	gb.graphCreateBinaryNode("sha2").properties["sha256"] = "sha256-2"
+	gb.graphCreateBinaryNode("sha3")
+
+	assert.NoError(t, gb.addXraySummaries())
+	assert.Equal(t, "npm://lodash:4.17.15", binary.properties["component_id"])
+	assert.Equal(t, []string{"CVE-2020-8203", "CVE-2021-23337"}, binary.properties["cves"])
+	assert.Equal(t, []string{"Apache-2.0", "MIT"}, binary.properties["licenses"])
+	assert.Equal(t, "Critical", binary.properties["max_severity"])
+	assert.Equal(t, map[string]int{labelBinary: 3, labelVulnerability: 2}, gb.graph.nodeCounts())
+	vulnerability := gb.graph.getNode(labelVulnerability, "XRAY-2")
+	if assert.NotNil(t, vulnerability) {
+		assert.Equal(t, []string{"CVE-2021-23337"}, vulnerability.properties["cves"])
+		assert.Contains(t, gb.graph.edgeById, edgeId(relAffectedBy, binary, vulnerability))
+	}
+	assert.NotContains(t, gb.graph.getNode(labelBinary, "sha2").properties, "cves")
+}
+
+func TestXrayClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/xray/api/v1/summary/artifact" || string(body) != `{"checksums":["sha256-1"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(testXraySummaries))
+	}))
+	defer server.Close()
+	client, err := newXrayClient(&config.ServerDetails{XrayUrl: server.URL + "/xray/"})
+	assert.NoError(t, err)
+	summaries, err := client.getArtifactSummaries([]string{"sha256-1"})
+	assert.NoError(t, err)
+	if assert.Len(t, summaries, 1) {
+		assert.Equal(t, "npm://lodash:4.17.15", summaries[0].General.ComponentId)
+		assert.Len(t, summaries[0].Issues, 3)
+	}
+	_, err = client.getArtifactSummaries([]string{"sha256-2"})
+	assert.Error(t, err)
+
+	_, err = newXrayClient(&config.ServerDetails{})
+	assert.Error(t, err)
+}
+
+func TestFileSummaryProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summaries.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testXraySummaries), 0644))
+	provider, err := newFileSummaryProvider(path)
+	assert.NoError(t, err)
+	summaries, err := provider.getArtifactSummaries([]string{"sha256-1", "sha256-2"})
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 1)
+}
+
+func TestSeverityRank(t *testing.T) {
+	assert.True(t, severityRank("critical") > severityRank("High"))
+	assert.True(t, severityRank("Low") > severityRank(""))
+	assert.Equal(t, 0, severityRank("Whatever"))
+}
@@ -23,5 +23,8 @@ func getCommands() []components.Command {
 	return []components.Command{
 		commands.GetAuditCommand(),
 		commands.GetGraphCommand(),
+		commands.GetWatchCommand(),
+		commands.GetPathsCommand(),
+		commands.GetCacheCommand(),
 	}
 }